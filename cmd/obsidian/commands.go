@@ -0,0 +1,286 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	scrape "github.com/scottkirkwood/obsidian"
+	"github.com/scottkirkwood/obsidian/config"
+	"github.com/scottkirkwood/obsidian/goodreads"
+	"github.com/scottkirkwood/obsidian/kindle"
+	"github.com/scottkirkwood/obsidian/stats"
+)
+
+// given returns the names of the flags set on the command line.
+func given(fs *flag.FlagSet) map[string]bool {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
+// absPath makes a path from a flag absolute so the config doesn't take it
+// as relative to the vault.
+func absPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	abs, err := filepath.Abs(config.ExpandPath(path))
+	if err != nil {
+		return path
+	}
+	return abs
+}
+
+func goodreadsImport(fs *flag.FlagSet) func(g *global, args []string) error {
+	dir := fs.String("dir", "", "Folder to place .md files, overrides the config")
+	inFile := fs.String("in", goodreads.DefaultInput, "File containing goodreads info in csv format, overrides the config")
+	templateFile := fs.String("template", "", "Template to use, overrides the config")
+	update := fs.Bool("update", false, "Only update the frontmatter keys goodreads owns in existing notes, overrides the config")
+	dailyNotes := fs.Bool("daily", false, "List the books finished and added in the daily notes, overrides the config")
+	from := fs.String("from", "goodreads", "Service the -in export is from: goodreads, storygraph or librarything, overrides the config")
+	return func(g *global, args []string) error {
+		if len(args) > 0 {
+			return usageError{fmt.Sprintf("unexpected arguments %q", args)}
+		}
+		set := given(fs)
+		gr := &g.conf.Goodreads
+		if set["dir"] {
+			gr.Dir = absPath(*dir)
+		}
+		if set["in"] {
+			gr.Input = absPath(*inFile)
+		}
+		if set["template"] {
+			gr.Template = absPath(*templateFile)
+		}
+		if set["update"] {
+			gr.Update = *update
+		}
+		if set["from"] {
+			gr.Source = *from
+		}
+		if set["daily"] {
+			gr.Daily = *dailyNotes
+		}
+		c := goodreads.FromConfig(g.conf)
+		c.DryRun = g.dryRun
+		return c.Import()
+	}
+}
+
+func kindleImport(fs *flag.FlagSet) func(g *global, args []string) error {
+	dir := fs.String("dir", "", "Folder of the book notes, overrides the config")
+	inFile := fs.String("in", kindle.DefaultInput, "File containing highlights and notes, overrides the config")
+	markDeleted := fs.Bool("mark-deleted", false, "Tag highlights that are no longer on the Kindle")
+	threshold := fs.Float64("threshold", 0.8, "How similar, from 0 to 1, a note's title and author must be to match, overrides the config")
+	aliases := fs.String("aliases", "", "File of Kindle title => note names, defaults to .kindle-aliases in -dir")
+	asins := fs.String("asins", "", "File of Kindle title => ASIN for links to the highlights, defaults to .kindle-asins in -dir")
+	resolve := fs.Bool("resolve", false, "Ask which note unmatched titles belong to and remember it in -aliases")
+	create := fs.Bool("create", false, "Create a note from -template for titles without one")
+	templateFile := fs.String("template", "", "Template for notes made with -create, overrides the config")
+	review := fs.String("review", "kindle-review.md", "Where to list the titles that matched several or no notes, overrides the config")
+	format := fs.String("format", "", "Format of -in: clippings, notebook, kobo, apple or koreader, guessed from its name if empty, overrides the config")
+	atomic := fs.String("atomic", "", "Folder to write a note per highlight in, indexed in the book note, overrides the config")
+	names := fs.String("names", "words", "How -atomic notes are named: words, the start of the highlight, or id")
+	dailyNotes := fs.Bool("daily", false, "List the highlights made in the daily notes, overrides the config")
+	blocks := fs.String("blocks", "", "Template of each highlight: blockquote, callout, table or a file, overrides the config")
+	return func(g *global, args []string) error {
+		if len(args) > 0 {
+			return usageError{fmt.Sprintf("unexpected arguments %q", args)}
+		}
+		set := given(fs)
+		k := &g.conf.Kindle
+		if set["dir"] {
+			k.Dir = absPath(*dir)
+		}
+		if set["in"] {
+			k.Input = absPath(*inFile)
+		}
+		if set["threshold"] {
+			k.Threshold = *threshold
+		}
+		if set["aliases"] {
+			k.Aliases = absPath(*aliases)
+		}
+		if set["asins"] {
+			k.ASINs = absPath(*asins)
+		}
+		if set["template"] {
+			k.Template = absPath(*templateFile)
+		}
+		if set["review"] {
+			k.Review = absPath(*review)
+		}
+		if set["format"] {
+			k.Format = *format
+		}
+		if set["atomic"] {
+			k.Atomic = absPath(*atomic)
+		}
+		if set["names"] {
+			k.Names = *names
+		}
+		if set["daily"] {
+			k.Daily = *dailyNotes
+		}
+		if set["blocks"] {
+			k.Blocks = *blocks
+			if filepath.Ext(*blocks) != "" {
+				k.Blocks = absPath(*blocks)
+			}
+		}
+		c := kindle.FromConfig(g.conf)
+		c.DryRun = g.dryRun
+		c.MarkDeleted = *markDeleted
+		c.Resolve = *resolve
+		c.Create = *create
+		return c.Import()
+	}
+}
+
+func statsCommand(fs *flag.FlagSet) func(g *global, args []string) error {
+	inFile := fs.String("in", goodreads.DefaultInput, "Goodreads csv export to count the books of, overrides the config")
+	from := fs.String("from", "goodreads", "Service the -in export is from: goodreads, storygraph or librarything, overrides the config")
+	clippings := fs.String("clippings", kindle.DefaultInput, "Highlights to count, in any format kindle import reads, skipped if it doesn't exist, overrides the config")
+	format := fs.String("format", "", "Format of -clippings: clippings, notebook, kobo, apple or koreader, guessed from its name if empty, overrides the config")
+	out := fs.String("out", stats.DefaultOutput, "Note to write the statistics to, overrides the config")
+	return func(g *global, args []string) error {
+		if len(args) > 0 {
+			return usageError{fmt.Sprintf("unexpected arguments %q", args)}
+		}
+		set := given(fs)
+		if set["in"] {
+			g.conf.Goodreads.Input = absPath(*inFile)
+		}
+		if set["from"] {
+			g.conf.Goodreads.Source = *from
+		}
+		if set["clippings"] {
+			g.conf.Kindle.Input = absPath(*clippings)
+		}
+		if set["format"] {
+			g.conf.Kindle.Format = *format
+		}
+		if set["out"] {
+			g.conf.Stats.Output = absPath(*out)
+		}
+		books, err := goodreads.FromConfig(g.conf).ReadCSV()
+		if err != nil {
+			return err
+		}
+		report := &stats.Report{Books: books}
+		k := kindle.FromConfig(g.conf)
+		input := kindle.DefaultInput
+		if g.conf.Kindle.Input != "" {
+			input = g.conf.Path(g.conf.Kindle.Input)
+		}
+		if fileExists(input) {
+			if err := k.Load(); err != nil {
+				return err
+			}
+			if err := k.LookupExisting(); err != nil {
+				return fmt.Errorf("unable to lookup existing: %v", err)
+			}
+			if report.Highlights, err = k.HighlightCounts(); err != nil {
+				return err
+			}
+		} else {
+			fmt.Printf("No highlights, %q doesn't exist\n", input)
+		}
+		output := stats.DefaultOutput
+		if g.conf.Stats.Output != "" {
+			output = g.conf.Stats.Output
+		}
+		return report.Write(g.conf.Path(output), g.dryRun)
+	}
+}
+
+// fileExists is true if fname exists
+func fileExists(fname string) bool {
+	_, err := os.Stat(fname)
+	return err == nil
+}
+
+func syncCommand(fs *flag.FlagSet) func(g *global, args []string) error {
+	return func(g *global, args []string) error {
+		if len(args) > 0 {
+			return usageError{fmt.Sprintf("unexpected arguments %q", args)}
+		}
+		return syncVault(g.conf.VaultDir(), g.dryRun)
+	}
+}
+
+// syncVault pulls, then commits and pushes any changes in dir.
+func syncVault(dir string, dryRun bool) error {
+	git := func(args ...string) (string, error) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return string(out), fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, out)
+		}
+		return string(out), nil
+	}
+	if !dryRun {
+		if _, err := git("pull", "-q"); err != nil {
+			return err
+		}
+	}
+	changes, err := git("status", "--porcelain")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(changes) == "" {
+		return nil
+	}
+	if dryRun {
+		fmt.Printf("Would commit and push:\n%s", changes)
+		return nil
+	}
+	if _, err := git("add", "."); err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("Last Sync: %s", time.Now().Format("2006-01-02 15:04:05"))
+	if _, err := git("commit", "-q", "-m", msg); err != nil {
+		return err
+	}
+	_, err = git("push", "-q")
+	return err
+}
+
+func scrapeCommand(fs *flag.FlagSet) func(g *global, args []string) error {
+	noCache := fs.Bool("no-cache", false, "Always fetch instead of using a recent cached copy")
+	verbose := fs.Int("v", 1, "Verbosity, 0 is quiet")
+	return func(g *global, args []string) error {
+		if len(args) == 0 {
+			return usageError{"missing url"}
+		}
+		conn := scrape.NewConn()
+		conn.Verbose = *verbose
+		if g.conf.Scrape.Cookies != "" {
+			conn.CookieJarFname = g.conf.Path(g.conf.Scrape.Cookies)
+		}
+		if g.conf.Scrape.Cache != "" {
+			conn.CacheNameFmt = g.conf.Path(g.conf.Scrape.Cache)
+		}
+		expire := scrape.NormalTimeout
+		if *noCache {
+			expire = scrape.NoCache
+		}
+		for _, uri := range args {
+			_, contents, _, err := conn.FetchAndCache(uri, expire)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(os.Stdout, contents)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,146 @@
+// obsidian keeps an Obsidian vault up to date with Goodreads, Kindle
+// highlights and its git remote.
+//
+// Usage:
+//
+//	obsidian [-vault dir] [-config file] [-dry-run] <command> [flags] [args]
+//
+// Exit codes are 0 on success, 1 if the command failed and 2 for bad usage.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/scottkirkwood/obsidian/config"
+)
+
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// global is the state shared by all the commands
+type global struct {
+	conf   *config.Config
+	dryRun bool
+}
+
+// command is a subcommand like "kindle import"
+type command struct {
+	name  string
+	args  string
+	help  string
+	flags func(fs *flag.FlagSet) func(g *global, args []string) error
+}
+
+// usageError is returned by commands given the wrong arguments
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+var commands = []command{
+	{"goodreads import", "", "Convert a goodreads csv export to book notes", goodreadsImport},
+	{"kindle import", "", "Add Kindle highlights to the book notes", kindleImport},
+	{"stats", "", "Write a note with reading statistics from goodreads and the highlights", statsCommand},
+	{"sync", "", "Commit changes in the vault and push them", syncCommand},
+	{"scrape", "url...", "Fetch pages and print them", scrapeCommand},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	fs := flag.NewFlagSet("obsidian", flag.ContinueOnError)
+	vault := fs.String("vault", "", "Folder of the Obsidian vault, overrides the config file")
+	configFile := fs.String("config", "", "Config file with the vault settings, defaults to .obsidian/"+config.FileName+" in the vault or the user config dir")
+	dryRun := fs.Bool("dry-run", false, "Show what would change without writing anything")
+	fs.Usage = func() { usage(fs) }
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	cmd, cmdArgs := findCommand(fs.Args())
+	if cmd == nil {
+		if fs.NArg() > 0 {
+			fmt.Fprintf(os.Stderr, "Unknown command %q\n", strings.Join(fs.Args(), " "))
+		}
+		fs.Usage()
+		return exitUsage
+	}
+
+	g := &global{dryRun: *dryRun}
+	var err error
+	if *configFile != "" {
+		g.conf, err = config.Load(*configFile)
+	} else {
+		g.conf, err = config.Discover(".")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to load config: %v\n", err)
+		return exitError
+	}
+	if *vault != "" {
+		g.conf.Vault = *vault
+	}
+
+	cmdFlags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	runCmd := cmd.flags(cmdFlags)
+	cmdFlags.Usage = func() {
+		fmt.Fprintf(cmdFlags.Output(), "Usage: %s\n%s\n", strings.TrimSpace("obsidian "+cmd.name+" [flags] "+cmd.args), cmd.help)
+		cmdFlags.PrintDefaults()
+	}
+	if err := cmdFlags.Parse(cmdArgs); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if err := runCmd(g, cmdFlags.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "obsidian %s: %v\n", cmd.name, err)
+		var usageErr usageError
+		if errors.As(err, &usageErr) {
+			cmdFlags.Usage()
+			return exitUsage
+		}
+		return exitError
+	}
+	return exitOK
+}
+
+// findCommand returns the command named by the first words of args
+// and the rest of args.
+func findCommand(args []string) (*command, []string) {
+	for i := range commands {
+		words := strings.Fields(commands[i].name)
+		if len(args) < len(words) {
+			continue
+		}
+		if strings.Join(args[:len(words)], " ") == commands[i].name {
+			return &commands[i], args[len(words):]
+		}
+	}
+	return nil, args
+}
+
+func usage(fs *flag.FlagSet) {
+	out := fs.Output()
+	fmt.Fprintf(out, "Usage: obsidian [flags] <command> [command flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-18s %s\n", cmd.name, cmd.help)
+	}
+	fmt.Fprintf(out, "\nFlags:\n")
+	fs.PrintDefaults()
+}
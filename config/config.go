@@ -0,0 +1,251 @@
+// Package config reads the settings shared by the obsidian tools.
+//
+// The file is TOML, read with github.com/BurntSushi/toml, and any key
+// that isn't a setting is an error.
+//
+//	vault = "~/zk/Zettelkasten"
+//	books = "books"
+//
+//	[goodreads]
+//	template = "templates/book.md"
+//
+//	[goodreads.tags]
+//	audio-book = "audiobook"
+//	to-read = ""
+//
+//	[kindle]
+//	header = "## Highlights"
+//	tags = ["book", "kindle"]
+//
+// Relative paths in the file are relative to the vault.
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+const (
+	// FileName is the name of the config file in the .obsidian folder of
+	// the vault, or in the obsidian folder of the user config dir.
+	FileName  = "tools.toml"
+	obsidian  = ".obsidian"
+	xdgFolder = "obsidian"
+)
+
+// Config is the settings for the vault.
+type Config struct {
+	// Vault is the root folder of the Obsidian vault
+	Vault string `toml:"vault"`
+	// Books is the folder for book notes, relative to Vault
+	Books string `toml:"books"`
+
+	Goodreads Goodreads `toml:"goodreads"`
+	Kindle    Kindle    `toml:"kindle"`
+	Daily     Daily     `toml:"daily"`
+	Stats     Stats     `toml:"stats"`
+	Scrape    Scrape    `toml:"scrape"`
+
+	// File is where the settings were read from, empty for the defaults
+	File string `toml:"-"`
+	// set are the keys found in File
+	set map[string]bool
+}
+
+// Goodreads is the [goodreads] section
+type Goodreads struct {
+	// Dir is the folder for the notes, defaults to Books
+	Dir      string `toml:"dir"`
+	Input    string `toml:"input"`    // Empty for goodreads.csv in the current folder
+	Template string `toml:"template"` // Empty for the built in one
+	State    string `toml:"state"`    // Empty for .goodreads in Dir
+	Source   string `toml:"source"`   // The service Input is from, empty for goodreads
+	Update   bool   `toml:"update"`   // Only update the frontmatter of existing notes
+	Daily    bool   `toml:"daily"`    // List the books read and added in the daily notes
+	// Tags maps a shelf to the tag to use, an empty tag drops the shelf
+	Tags map[string]string `toml:"tags"`
+}
+
+// Kindle is the [kindle] section
+type Kindle struct {
+	// Dir is the folder with the book notes, defaults to Books
+	Dir      string `toml:"dir"`
+	Input    string `toml:"input"`    // Empty for "My Clippings.txt" in the current folder
+	Format   string `toml:"format"`   // Format of Input, empty to guess it from its name
+	Template string `toml:"template"` // Empty for the built in one
+	Header   string `toml:"header"`   // Header of the highlights section
+	Blocks   string `toml:"blocks"`   // Template of each highlight, built in name or file, empty for blockquote
+	Aliases  string `toml:"aliases"`  // Empty for .kindle-aliases in Dir
+	ASINs    string `toml:"asins"`    // Empty for .kindle-asins in Dir
+	// Atomic is the folder for a note per highlight, empty to put them
+	// in the book notes
+	Atomic    string  `toml:"atomic"`
+	Names     string  `toml:"names"` // How Atomic notes are named, words or id
+	Daily     bool    `toml:"daily"` // List the highlights made in the daily notes
+	Review    string  `toml:"review"`
+	Threshold float64 `toml:"threshold"`
+	// Tags are given to the notes made for new books
+	Tags []string `toml:"tags"`
+}
+
+// Daily is the [daily] section, for the daily notes the importers list
+// what happened each day in
+type Daily struct {
+	Pattern string `toml:"pattern"` // Path of the daily notes with YYYY, MM, DD, empty for Daily/YYYY-MM-DD.md
+	Header  string `toml:"header"`  // Header the lists go under
+	Create  bool   `toml:"create"`  // Make the daily notes that don't exist
+}
+
+// Stats is the [stats] section
+type Stats struct {
+	Output string `toml:"output"` // Note with the statistics, empty for "Reading stats.md"
+}
+
+// Scrape is the [scrape] section
+type Scrape struct {
+	Cookies string `toml:"cookies"` // File to keep cookies in
+	Cache   string `toml:"cache"`   // Format of cache file names, given the md5 of the url
+}
+
+// Default returns the settings used when there is no config file.
+func Default() *Config {
+	return &Config{
+		Vault: "~/zk/Zettelkasten",
+		Books: "books",
+		Goodreads: Goodreads{
+			Tags: map[string]string{},
+		},
+		Kindle: Kindle{
+			Header:    "## Highlights",
+			Review:    "kindle-review.md",
+			Threshold: 0.8,
+			Tags:      []string{"book", "kindle"},
+		},
+		set: map[string]bool{},
+	}
+}
+
+// Find returns the config file to use for dir: the one in the .obsidian
+// folder of the vault dir is in, or else the one in the user config dir.
+// It returns "" if neither exist.
+func Find(dir string) string {
+	if vault := FindVault(dir); vault != "" {
+		fname := filepath.Join(vault, obsidian, FileName)
+		if _, err := os.Stat(fname); err == nil {
+			return fname
+		}
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	fname := filepath.Join(configDir, xdgFolder, FileName)
+	if _, err := os.Stat(fname); err != nil {
+		return ""
+	}
+	return fname
+}
+
+// FindVault walks up from dir to the first folder with a .obsidian folder.
+// It returns "" if there's none.
+func FindVault(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		if info, err := os.Stat(filepath.Join(dir, obsidian)); err == nil && info.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// Discover loads the config file Find returns for dir, or the Default
+// settings if there's none. When dir is in a vault it's used as the
+// Vault unless the file says otherwise.
+func Discover(dir string) (*Config, error) {
+	c := Default()
+	if fname := Find(dir); fname != "" {
+		var err error
+		if c, err = Load(fname); err != nil {
+			return c, err
+		}
+	}
+	if vault := FindVault(dir); vault != "" && !c.set["vault"] {
+		c.Vault = vault
+	}
+	return c, nil
+}
+
+// Load reads fname on top of the Default settings.
+func Load(fname string) (*Config, error) {
+	c := Default()
+	c.File = fname
+	meta, err := toml.DecodeFile(fname, c)
+	if err != nil {
+		return c, fmt.Errorf("%s: %v", fname, err)
+	}
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return c, fmt.Errorf("%s: unknown key %q", fname, undecoded[0].String())
+	}
+	for _, key := range meta.Keys() {
+		c.set[key.String()] = true
+	}
+	return c, nil
+}
+
+// VaultDir returns the expanded path of the vault.
+func (c *Config) VaultDir() string {
+	return ExpandPath(c.Vault)
+}
+
+// Path expands path and makes it relative to the vault if it isn't absolute.
+// An empty path stays empty.
+func (c *Config) Path(path string) string {
+	if path == "" {
+		return ""
+	}
+	path = ExpandPath(path)
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(c.VaultDir(), path)
+}
+
+// BooksDir returns the expanded path of the book notes folder.
+func (c *Config) BooksDir() string {
+	return c.Path(c.Books)
+}
+
+// GoodreadsDir returns the folder for the goodreads notes.
+func (c *Config) GoodreadsDir() string {
+	if c.Goodreads.Dir == "" {
+		return c.BooksDir()
+	}
+	return c.Path(c.Goodreads.Dir)
+}
+
+// KindleDir returns the folder of the notes the highlights go in.
+func (c *Config) KindleDir() string {
+	if c.Kindle.Dir == "" {
+		return c.BooksDir()
+	}
+	return c.Path(c.Kindle.Dir)
+}
+
+// ExpandPath replaces a leading ~ and any environment variables in path.
+func ExpandPath(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		path = "$HOME" + path[1:]
+	}
+	return os.ExpandEnv(path)
+}
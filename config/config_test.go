@@ -0,0 +1,152 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testConfig = `vault = "/v"
+books = "Books"
+
+[goodreads]
+template = "templates/book.md"
+input = "/in/goodreads.csv"
+
+[goodreads.tags]
+audio-book = "audiobook" # renamed
+to-read = ""
+
+[kindle]
+dir = "/elsewhere"
+header = "## Kindle"
+threshold = 0.7
+tags = ["book", "highlights"]
+daily = true
+
+[daily]
+pattern = "Journal/YYYY/YYYY-MM-DD.md"
+create = true
+`
+
+func TestLoad(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), FileName)
+	if err := os.WriteFile(fname, []byte(testConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := Load(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, got, want string
+	}{
+		{"BooksDir", c.BooksDir(), filepath.Join("/v", "Books")},
+		{"GoodreadsDir", c.GoodreadsDir(), filepath.Join("/v", "Books")},
+		{"KindleDir", c.KindleDir(), "/elsewhere"},
+		{"Goodreads.Template", c.Path(c.Goodreads.Template), filepath.Join("/v", "templates", "book.md")},
+		{"Goodreads.Input", c.Path(c.Goodreads.Input), "/in/goodreads.csv"},
+		{"Kindle.Header", c.Kindle.Header, "## Kindle"},
+		{"Kindle.Review", c.Kindle.Review, "kindle-review.md"},
+		{"Daily.Pattern", c.Daily.Pattern, "Journal/YYYY/YYYY-MM-DD.md"},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s -> %q, want %q", test.name, test.got, test.want)
+		}
+	}
+	if want := map[string]string{"audio-book": "audiobook", "to-read": ""}; !reflect.DeepEqual(c.Goodreads.Tags, want) {
+		t.Errorf("Goodreads.Tags -> %q, want %q", c.Goodreads.Tags, want)
+	}
+	if want := []string{"book", "highlights"}; !reflect.DeepEqual(c.Kindle.Tags, want) {
+		t.Errorf("Kindle.Tags -> %q, want %q", c.Kindle.Tags, want)
+	}
+	if !c.Kindle.Daily || !c.Daily.Create || c.Goodreads.Daily {
+		t.Errorf("Kindle.Daily, Daily.Create, Goodreads.Daily -> %v, %v, %v, want true, true, false", c.Kindle.Daily, c.Daily.Create, c.Goodreads.Daily)
+	}
+	if c.Kindle.Threshold != 0.7 {
+		t.Errorf("Kindle.Threshold -> %v, want 0.7", c.Kindle.Threshold)
+	}
+
+	for _, bad := range []string{"unknown = 1\n", "[kindle]\nthreshold = high\n", "[kindle\n", "[kindle]\nheadr = \"x\"\n"} {
+		if err := os.WriteFile(fname, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(fname); err == nil {
+			t.Errorf("%q expected an error", bad)
+		}
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), FileName)
+	in := `books = 'Book # notes'
+goodreads.tags = { "to-read" = "", currently-reading = "reading" }
+
+[kindle]
+tags = [
+  "book",  # the base tag
+  'kindle',
+]
+header = """
+## Highlights"""
+`
+	if err := os.WriteFile(fname, []byte(in), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := Load(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Books != "Book # notes" || c.Kindle.Header != "## Highlights" {
+		t.Errorf("Books, Kindle.Header -> %q, %q, want %q, %q", c.Books, c.Kindle.Header, "Book # notes", "## Highlights")
+	}
+	if want := map[string]string{"to-read": "", "currently-reading": "reading"}; !reflect.DeepEqual(c.Goodreads.Tags, want) {
+		t.Errorf("Goodreads.Tags -> %q, want %q", c.Goodreads.Tags, want)
+	}
+	if want := []string{"book", "kindle"}; !reflect.DeepEqual(c.Kindle.Tags, want) {
+		t.Errorf("Kindle.Tags -> %q, want %q", c.Kindle.Tags, want)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "config"))
+	vault := filepath.Join(home, "vault")
+	sub := filepath.Join(vault, "books", "fiction")
+	for _, dir := range []string{filepath.Join(vault, obsidian), sub, filepath.Join(home, "config", xdgFolder)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	userConf := filepath.Join(home, "config", xdgFolder, FileName)
+	if err := os.WriteFile(userConf, []byte("books = \"from-user\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := Find(home); got != userConf {
+		t.Errorf("Find outside the vault -> %q, want %q", got, userConf)
+	}
+	c, err := Discover(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Vault != vault || c.Books != "from-user" {
+		t.Errorf("Discover without a vault config -> %q, %q, want %q, %q", c.Vault, c.Books, vault, "from-user")
+	}
+
+	vaultConf := filepath.Join(vault, obsidian, FileName)
+	if err := os.WriteFile(vaultConf, []byte("books = \"from-vault\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := Find(sub); got != vaultConf {
+		t.Errorf("Find in the vault -> %q, want %q", got, vaultConf)
+	}
+	if c, err = Discover(sub); err != nil {
+		t.Fatal(err)
+	}
+	if c.Vault != vault || c.Books != "from-vault" {
+		t.Errorf("Discover -> %q, %q, want %q, %q", c.Vault, c.Books, vault, "from-vault")
+	}
+}
@@ -0,0 +1,322 @@
+// Package daily keeps a region of the daily notes up to date with what a
+// tool saw happen that day, like the highlights made or books finished.
+//
+// Each tool has its own region, see package region, under a shared header:
+//
+//	## Reading
+//
+//	%% begin kindle %%
+//	- Highlighted [[Book#^kindle-8c1a2f3e-98-99|Book]]: Every moment in…
+//	%% end kindle %%
+package daily
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/scottkirkwood/obsidian/config"
+	"github.com/scottkirkwood/obsidian/region"
+)
+
+const (
+	// DefaultPattern is where the daily notes are, like Obsidian's
+	// Daily notes plugin with its folder set to Daily
+	DefaultPattern = "Daily/YYYY-MM-DD.md"
+	// DefaultHeader is put before the regions
+	DefaultHeader = "## Reading"
+	// dayLayout is the key of Days
+	dayLayout = "2006-01-02"
+	// maxText is how many characters of a highlight are shown
+	maxText = 100
+)
+
+// Conf says where the daily notes are.
+type Conf struct {
+	// Dir is the vault, Pattern is relative to it
+	Dir string
+	// Pattern is the path of a daily note, with YYYY, YY, MMMM, MMM, MM, M,
+	// DD, D, dddd and ddd replaced by the date like Obsidian does.
+	// Text in [brackets] is kept as is.
+	Pattern string
+	// Header is where a region is added to a note without it
+	Header string
+	// Create makes the daily notes that don't exist, otherwise only
+	// existing daily notes are changed
+	Create bool
+}
+
+// FromConfig returns the Conf for the [daily] settings of conf.
+func FromConfig(conf *config.Config) *Conf {
+	c := &Conf{
+		Dir:     conf.VaultDir(),
+		Pattern: DefaultPattern,
+		Header:  DefaultHeader,
+		Create:  conf.Daily.Create,
+	}
+	if conf.Daily.Pattern != "" {
+		c.Pattern = conf.Daily.Pattern
+	}
+	if conf.Daily.Header != "" {
+		c.Header = conf.Daily.Header
+	}
+	return c
+}
+
+// entry is a line of a daily note and when it happened, to sort them
+type entry struct {
+	when time.Time
+	line string
+}
+
+// Days are the lines that go in the daily note of each day
+type Days map[string][]entry
+
+// Add adds line to the day of when.
+func (d Days) Add(when time.Time, line string) {
+	day := when.Format(dayLayout)
+	d[day] = append(d[day], entry{when, line})
+}
+
+// Lines returns the lines of day, in the order they happened.
+func (d Days) Lines(day string) []string {
+	entries := append([]entry(nil), d[day]...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].when.Before(entries[j].when)
+	})
+	lines := make([]string, len(entries))
+	for i, e := range entries {
+		lines[i] = e.line
+	}
+	return lines
+}
+
+// Update writes the lines of each of days to the region name of its daily
+// note. It returns how many notes were changed, or would be with dryRun,
+// which only shows them.
+func (c *Conf) Update(name string, days Days, dryRun bool) (int, error) {
+	sorted := make([]string, 0, len(days))
+	for day := range days {
+		sorted = append(sorted, day)
+	}
+	sort.Strings(sorted)
+	changed, missing := 0, 0
+	for _, day := range sorted {
+		t, err := time.Parse(dayLayout, day)
+		if err != nil {
+			return changed, err
+		}
+		fname := c.Filename(t)
+		ok, err := c.updateNote(fname, name, days.Lines(day), dryRun)
+		if os.IsNotExist(err) {
+			missing++
+			continue
+		} else if err != nil {
+			return changed, err
+		}
+		if ok {
+			changed++
+		}
+	}
+	if missing > 0 {
+		fmt.Printf("No daily note for %d days, set create in [daily] to make them\n", missing)
+	}
+	return changed, nil
+}
+
+// updateNote replaces the region name of fname with lines, adding it
+// under c.Header if it isn't there. It returns false if nothing changed,
+// and a not exist error if fname doesn't exist and !c.Create. With dryRun
+// it only says it would update it.
+func (c *Conf) updateNote(fname, name string, lines []string, dryRun bool) (bool, error) {
+	data, err := os.ReadFile(fname)
+	if os.IsNotExist(err) && c.Create {
+		data, err = nil, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	txt := string(data)
+	var old []string
+	if txt != "" {
+		old = strings.Split(txt, "\n")
+	}
+	updated, ok := region.Replace(old, name, lines)
+	if !ok {
+		updated = addRegion(old, c.Header, region.Wrap(name, lines))
+	}
+	newTxt := strings.Join(updated, "\n")
+	if !strings.HasSuffix(newTxt, "\n") {
+		newTxt += "\n"
+	}
+	if newTxt == txt {
+		return false, nil
+	}
+	if dryRun {
+		fmt.Printf("Would update %q\n", fname)
+		return true, nil
+	}
+	if txt == "" {
+		fmt.Printf("Creating %q\n", fname)
+		if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+			return false, err
+		}
+	} else {
+		fmt.Printf("Updating %q\n", fname)
+	}
+	return true, os.WriteFile(fname, []byte(newTxt), 0644)
+}
+
+// addRegion puts wrapped at the end of the section under header, after
+// the other tools' regions, or at the end of lines under a new header.
+func addRegion(lines []string, header string, wrapped []string) []string {
+	lines = trimBlankLines(lines)
+	start := -1
+	for i, line := range lines {
+		if line == header {
+			start = i
+			break
+		}
+	}
+	if start == -1 {
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, header, "")
+		return append(lines, wrapped...)
+	}
+	end := start + 1
+	for end < len(lines) && !strings.HasPrefix(lines[end], "#") {
+		end++
+	}
+	ret := append([]string(nil), trimBlankLines(lines[:end])...)
+	ret = append(append(ret, ""), wrapped...)
+	if end < len(lines) {
+		ret = append(ret, "")
+	}
+	return append(ret, lines[end:]...)
+}
+
+// trimBlankLines removes the blank lines at the end of lines.
+func trimBlankLines(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Filename returns the daily note of day.
+func (c *Conf) Filename(day time.Time) string {
+	pattern := c.Pattern
+	if pattern == "" {
+		pattern = DefaultPattern
+	}
+	fname := formatDate(pattern, day)
+	if filepath.IsAbs(fname) {
+		return fname
+	}
+	return filepath.Join(c.Dir, fname)
+}
+
+// dateTokens are the parts of Obsidian's (moment.js) date formats that
+// formatDate knows, longest first
+var dateTokens = []struct {
+	token  string
+	layout string
+}{
+	{"YYYY", "2006"},
+	{"YY", "06"},
+	{"MMMM", "January"},
+	{"MMM", "Jan"},
+	{"MM", "01"},
+	{"M", "1"},
+	{"DD", "02"},
+	{"D", "2"},
+	{"dddd", "Monday"},
+	{"ddd", "Mon"},
+}
+
+// formatDate replaces the date tokens of pattern with t.
+// A run of letters is only replaced if it's all tokens, so the folder in
+// Daily/YYYY-MM-DD.md is kept. Text in [brackets] is copied without them.
+func formatDate(pattern string, t time.Time) string {
+	var out strings.Builder
+	for i := 0; i < len(pattern); {
+		if pattern[i] == '[' {
+			if end := strings.IndexByte(pattern[i:], ']'); end != -1 {
+				out.WriteString(pattern[i+1 : i+end])
+				i += end + 1
+				continue
+			}
+		}
+		end := i
+		for end < len(pattern) && isLetter(pattern[end]) {
+			end++
+		}
+		if end == i {
+			out.WriteByte(pattern[i])
+			i++
+			continue
+		}
+		if formatted, ok := formatTokens(pattern[i:end], t); ok {
+			out.WriteString(formatted)
+		} else {
+			out.WriteString(pattern[i:end])
+		}
+		i = end
+	}
+	return out.String()
+}
+
+// formatTokens formats word if it's only made of dateTokens.
+func formatTokens(word string, t time.Time) (string, bool) {
+	var out strings.Builder
+	for word != "" {
+		matched := false
+		for _, tok := range dateTokens {
+			if strings.HasPrefix(word, tok.token) {
+				out.WriteString(t.Format(tok.layout))
+				word = word[len(tok.token):]
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return "", false
+		}
+	}
+	return out.String(), true
+}
+
+func isLetter(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+// Link is a wikilink to the note fname, or a heading or block of it when
+// target isn't empty, shown as the note's name.
+func Link(fname, target string) string {
+	name := strings.TrimSuffix(filepath.Base(fname), filepath.Ext(fname))
+	if target == "" {
+		return "[[" + name + "]]"
+	}
+	return "[[" + name + "#" + target + "|" + name + "]]"
+}
+
+// Shorten returns the first line of txt, cut at a word to about maxText
+// characters.
+func Shorten(txt string) string {
+	txt = strings.TrimSpace(strings.SplitN(strings.TrimSpace(txt), "\n", 2)[0])
+	if utf8.RuneCountInString(txt) <= maxText {
+		return txt
+	}
+	runes := []rune(txt)[:maxText]
+	cut := string(runes)
+	if idx := strings.LastIndex(cut, " "); idx > maxText/2 {
+		cut = cut[:idx]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
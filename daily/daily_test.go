@@ -0,0 +1,115 @@
+package daily
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatDate(t *testing.T) {
+	day := time.Date(2021, 12, 5, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		pattern, want string
+	}{
+		{DefaultPattern, "Daily/2021-12-05.md"},
+		{"Journal/YYYY/MMMM/YYYYMMDD dddd.md", "Journal/2021/December/20211205 Sunday.md"},
+		{"[YYYY] D-M-YY ddd MMM.md", "YYYY 5-12-21 Sun Dec.md"},
+		{"Days/DD.md", "Days/05.md"},
+	}
+	for _, test := range tests {
+		if got := formatDate(test.pattern, day); got != test.want {
+			t.Errorf("formatDate(%q) = %q, want %q", test.pattern, got, test.want)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	dir := t.TempDir()
+	c := &Conf{Dir: dir, Pattern: DefaultPattern, Header: DefaultHeader}
+	existing := filepath.Join(dir, "Daily", "2021-12-05.md")
+	if err := os.MkdirAll(filepath.Dir(existing), 0755); err != nil {
+		t.Fatal(err)
+	}
+	note := "# Sunday\n\nWrote things\n\n## Reading\n\n%% begin goodreads %%\n- Finished [[Book]]\n%% end goodreads %%\n\n## Later\n"
+	if err := os.WriteFile(existing, []byte(note), 0644); err != nil {
+		t.Fatal(err)
+	}
+	days := Days{}
+	days.Add(time.Date(2021, 12, 5, 20, 0, 0, 0, time.UTC), "- Second")
+	days.Add(time.Date(2021, 12, 5, 8, 0, 0, 0, time.UTC), "- First")
+	days.Add(time.Date(2021, 12, 6, 8, 0, 0, 0, time.UTC), "- Missing")
+	changed, err := c.Update("kindle", days, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != 1 {
+		t.Errorf("Update changed %d, want 1", changed)
+	}
+	data, err := os.ReadFile(existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# Sunday\n\nWrote things\n\n## Reading\n\n%% begin goodreads %%\n- Finished [[Book]]\n%% end goodreads %%\n\n" +
+		"%% begin kindle %%\n- First\n- Second\n%% end kindle %%\n\n## Later\n"
+	if string(data) != want {
+		t.Errorf("Update ->\n%s\nwant\n%s", data, want)
+	}
+	if _, err := os.Stat(c.Filename(time.Date(2021, 12, 6, 0, 0, 0, 0, time.UTC))); err == nil {
+		t.Errorf("Update made a daily note without Create")
+	}
+
+	// The region is replaced, and running again changes nothing
+	days = Days{}
+	days.Add(time.Date(2021, 12, 5, 8, 0, 0, 0, time.UTC), "- Only")
+	if _, err := c.Update("kindle", days, false); err != nil {
+		t.Fatal(err)
+	}
+	if changed, _ := c.Update("kindle", days, false); changed != 0 {
+		t.Errorf("second Update changed %d, want 0", changed)
+	}
+	data, _ = os.ReadFile(existing)
+	if got := string(data); !strings.Contains(got, "%% begin kindle %%\n- Only\n%% end kindle %%") || strings.Contains(got, "Second") {
+		t.Errorf("Update didn't replace the region:\n%s", got)
+	}
+
+	c.Create = true
+	days = Days{}
+	days.Add(time.Date(2021, 12, 6, 8, 0, 0, 0, time.UTC), "- New")
+	if changed, err := c.Update("kindle", days, true); err != nil || changed != 1 {
+		t.Errorf("dry run Update -> %d, %v, want 1", changed, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Daily", "2021-12-06.md")); err == nil {
+		t.Errorf("dry run Update made a daily note")
+	}
+	if _, err := c.Update("kindle", days, false); err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(filepath.Join(dir, "Daily", "2021-12-06.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "## Reading\n\n%% begin kindle %%\n- New\n%% end kindle %%\n"; string(data) != want {
+		t.Errorf("created ->\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestShorten(t *testing.T) {
+	long := strings.Repeat("word ", 30)
+	tests := []struct {
+		in, want string
+	}{
+		{"Short.", "Short."},
+		{"First line\nsecond line", "First line"},
+		{long, strings.TrimSpace(strings.Repeat("word ", 20)) + "…"},
+	}
+	for _, test := range tests {
+		if got := Shorten(test.in); got != test.want {
+			t.Errorf("Shorten(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+	if got, want := Link("/v/books/Book.md", "^id"), "[[Book#^id|Book]]"; got != want {
+		t.Errorf("Link -> %q, want %q", got, want)
+	}
+}
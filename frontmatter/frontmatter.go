@@ -0,0 +1,314 @@
+// Package frontmatter reads and writes the YAML block found between the
+// `---` lines at the top of an Obsidian note.
+//
+// The YAML is parsed with gopkg.in/yaml.v3 into a yaml.Node, so fields
+// keep the order and comments they were read with.
+// A frontmatter that wasn't modified is written back exactly as it was found.
+package frontmatter
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const delim = "---"
+
+// Frontmatter is the ordered set of fields of a note.
+type Frontmatter struct {
+	// node is the mapping of the fields
+	node *yaml.Node
+	// comment is the comment before the fields, kept by the document node
+	comment string
+	// raw is the YAML as read, written back while dirty is false
+	raw   string
+	dirty bool
+}
+
+// New returns an empty Frontmatter.
+func New() *Frontmatter {
+	return &Frontmatter{node: &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}}
+}
+
+// ReadFile reads fname and returns its frontmatter and the rest of the note.
+func ReadFile(fname string) (*Frontmatter, []byte, error) {
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return New(), nil, err
+	}
+	return Parse(data)
+}
+
+// WriteFile writes the frontmatter f followed by body to fname.
+func WriteFile(fname string, f *Frontmatter, body []byte) error {
+	return os.WriteFile(fname, Marshal(f, body), 0644)
+}
+
+// Parse splits data into its frontmatter and body.
+// If data doesn't start with a `---` line the frontmatter is empty and
+// the body is all of data.
+func Parse(data []byte) (*Frontmatter, []byte, error) {
+	f := New()
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	lines := strings.SplitAfter(text, "\n")
+	if len(lines) == 0 || trimEOL(lines[0]) != delim {
+		return f, data, nil
+	}
+	offset := len(data) - len(text) + len(lines[0])
+	var yamlLines []string
+	for _, line := range lines[1:] {
+		offset += len(line)
+		if l := trimEOL(line); l == delim || l == "..." {
+			if err := f.parse(yamlLines); err != nil {
+				return f, data[offset:], err
+			}
+			return f, data[offset:], nil
+		}
+		yamlLines = append(yamlLines, trimEOL(line))
+	}
+	return f, data, fmt.Errorf("frontmatter: missing closing %q", delim)
+}
+
+// Marshal returns the note made of f and body.
+// An empty frontmatter is left out entirely.
+func Marshal(f *Frontmatter, body []byte) []byte {
+	if f == nil || (f.Len() == 0 && (f.dirty || f.raw == "")) {
+		return body
+	}
+	var buf bytes.Buffer
+	buf.WriteString(delim + "\n")
+	buf.WriteString(f.String())
+	buf.WriteString("\n" + delim + "\n")
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+// String returns the YAML lines of f without the `---` delimiters.
+func (f *Frontmatter) String() string {
+	if !f.dirty && f.raw != "" {
+		return f.raw
+	}
+	if len(f.node.Content) == 0 {
+		return ""
+	}
+	doc := &yaml.Node{Kind: yaml.DocumentNode, HeadComment: f.comment, Content: []*yaml.Node{f.node}}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		// Only nodes made by this package are encoded, so this can't happen
+		panic(fmt.Sprintf("frontmatter: %v", err))
+	}
+	return strings.TrimRight(buf.String(), "\n")
+}
+
+// Keys returns the keys of f in order.
+func (f *Frontmatter) Keys() []string {
+	keys := make([]string, 0, len(f.node.Content)/2)
+	for i := 0; i+1 < len(f.node.Content); i += 2 {
+		keys = append(keys, f.node.Content[i].Value)
+	}
+	return keys
+}
+
+// Len returns the number of keys in f.
+func (f *Frontmatter) Len() int {
+	return len(f.node.Content) / 2
+}
+
+// Has returns true if key is present, even if its value is empty.
+func (f *Frontmatter) Has(key string) bool {
+	return f.find(key) != nil
+}
+
+// Get returns the value of key.
+// Lists are joined with ", ".
+func (f *Frontmatter) Get(key string) string {
+	val := f.find(key)
+	if val == nil {
+		return ""
+	}
+	if val.Kind == yaml.SequenceNode {
+		return strings.Join(values(val), ", ")
+	}
+	return scalar(val)
+}
+
+// List returns the values of key.
+// Scalars are split on commas, the way goodreads writes its tags.
+func (f *Frontmatter) List(key string) []string {
+	val := f.find(key)
+	if val == nil {
+		return nil
+	}
+	if val.Kind == yaml.SequenceNode {
+		return values(val)
+	}
+	var vals []string
+	for _, item := range strings.Split(scalar(val), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			vals = append(vals, item)
+		}
+	}
+	return vals
+}
+
+// IsList returns true if key is a list rather than a scalar.
+func (f *Frontmatter) IsList(key string) bool {
+	val := f.find(key)
+	return val != nil && val.Kind == yaml.SequenceNode
+}
+
+// Set sets key to the scalar val, appending it if it's new.
+func (f *Frontmatter) Set(key, val string) {
+	if old := f.find(key); old != nil && old.Kind == yaml.ScalarNode && scalar(old) == val {
+		return
+	}
+	f.put(key, newScalar(val))
+}
+
+// SetList sets key to the list vals, appending it if it's new.
+func (f *Frontmatter) SetList(key string, vals []string) {
+	if old := f.find(key); old != nil && old.Kind == yaml.SequenceNode && equalStrings(values(old), vals) {
+		return
+	}
+	list := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	if len(vals) == 0 {
+		list.Style = yaml.FlowStyle
+	}
+	for _, val := range vals {
+		list.Content = append(list.Content, newScalar(val))
+	}
+	f.put(key, list)
+}
+
+// Delete removes key from f.
+func (f *Frontmatter) Delete(key string) {
+	for i := 0; i+1 < len(f.node.Content); i += 2 {
+		if f.node.Content[i].Value == key {
+			f.node.Content = append(f.node.Content[:i], f.node.Content[i+2:]...)
+			f.dirty = true
+			return
+		}
+	}
+}
+
+// find returns the value of key, or nil if it's missing.
+func (f *Frontmatter) find(key string) *yaml.Node {
+	for i := 0; i+1 < len(f.node.Content); i += 2 {
+		if f.node.Content[i].Value == key {
+			return f.node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// put replaces the value of key with val, or appends key if it's new.
+func (f *Frontmatter) put(key string, val *yaml.Node) {
+	f.dirty = true
+	for i := 0; i+1 < len(f.node.Content); i += 2 {
+		if f.node.Content[i].Value == key {
+			// Keep the comment after the old value
+			val.LineComment = f.node.Content[i+1].LineComment
+			f.node.Content[i+1] = val
+			return
+		}
+	}
+	f.node.Content = append(f.node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, val)
+}
+
+// newScalar returns the node of val, double quoted if it has to be.
+func newScalar(val string) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: val}
+	if needsQuote(val) {
+		node.Style = yaml.DoubleQuotedStyle
+	}
+	return node
+}
+
+// scalar returns the text of node, empty for null and for collections.
+func scalar(node *yaml.Node) string {
+	if node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	if node.Kind != yaml.ScalarNode || node.ShortTag() == "!!null" {
+		return ""
+	}
+	return node.Value
+}
+
+// values returns the scalars of the list node.
+func values(node *yaml.Node) []string {
+	vals := make([]string, 0, len(node.Content))
+	for _, item := range node.Content {
+		vals = append(vals, scalar(item))
+	}
+	return vals
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Quote returns val double quoted if it can't be written as a plain scalar.
+func Quote(val string) string {
+	if needsQuote(val) {
+		return fmt.Sprintf("%q", val)
+	}
+	return val
+}
+
+func needsQuote(val string) bool {
+	if val == "" || strings.TrimSpace(val) != val {
+		return true
+	}
+	if strings.ContainsAny(val, "':\n\r\t") || strings.Contains(val, " #") {
+		return true
+	}
+	if strings.ContainsRune(`[]{}>|*&!%@#"`+"`", rune(val[0])) {
+		return true
+	}
+	return strings.HasPrefix(val, "- ") || strings.HasPrefix(val, "? ") || val == "-"
+}
+
+func (f *Frontmatter) parse(lines []string) error {
+	f.raw = strings.Join(lines, "\n")
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(f.raw+"\n"), &doc); err != nil {
+		return fmt.Errorf("frontmatter: %v", err)
+	}
+	if len(doc.Content) == 0 {
+		// Only blank lines and comments
+		f.comment = strings.TrimSpace(f.raw)
+		return nil
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("frontmatter: line %d: expected key: value fields", doc.Content[0].Line+1)
+	}
+	f.node, f.comment = doc.Content[0], doc.HeadComment
+	seen := map[string]bool{}
+	for i := 0; i+1 < len(f.node.Content); i += 2 {
+		key := f.node.Content[i]
+		if seen[key.Value] {
+			// +1 for the opening delimiter
+			return fmt.Errorf("frontmatter: line %d: duplicate key %q", key.Line+1, key.Value)
+		}
+		seen[key.Value] = true
+	}
+	return nil
+}
+
+func trimEOL(line string) string {
+	return strings.TrimRight(line, " \t\r\n")
+}
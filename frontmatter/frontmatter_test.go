@@ -0,0 +1,146 @@
+package frontmatter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in       string
+		key      string
+		want     string
+		wantBody string
+	}{
+		{"", "title", "", ""},
+		{"no frontmatter\nNote: body", "Note", "", "no frontmatter\nNote: body"},
+		{"---\ntitle: Plain\n---\nbody", "title", "Plain", "body"},
+		{"---\ntitle: Plain\n---\nNote: something\n", "Note", "", "Note: something\n"},
+		{"\ufeff---\ntitle: BOM\n---\n", "title", "BOM", ""},
+		{"---\ntitle: \"Quoted: \\\"yes\\\"\"\n---\n", "title", `Quoted: "yes"`, ""},
+		{"---\ntitle: 'It''s'\n---\n", "title", "It's", ""},
+		{"---\nurl: https://example.com\n---\n", "url", "https://example.com", ""},
+		{"---\nisbn: 0593230574 # comment\n---\n", "isbn", "0593230574", ""},
+		{"---\nlong: first\n  second\n---\n", "long", "first second", ""},
+		{"---\ndesc: |\n  line one\n  line two\n---\n", "desc", "line one\nline two\n", ""},
+		{"---\ndesc: |-\n  line one\n\n  line two\n---\n", "desc", "line one\n\nline two", ""},
+		{"---\ndesc: >\n  folded\n  text\n---\n", "desc", "folded text\n", ""},
+		{"---\ntags: [book, \"a, b\"]\n---\n", "tags", "book, a, b", ""},
+		{"---\ntags:\n  - book\n  - to-read\n---\n", "tags", "book, to-read", ""},
+		{"---\ntags:\n- book\n---\n", "tags", "book", ""},
+		{"---\nempty:\nnext: 1\n---\n", "empty", "", ""},
+		{"---\ntags: [a,\n  b]\n---\n", "tags", "a, b", ""},
+		{"---\nnested: {key: 1}\ntitle: After\n---\n", "title", "After", ""},
+	}
+	for _, test := range tests {
+		f, body, err := Parse([]byte(test.in))
+		if err != nil {
+			t.Errorf("%q got error %v", test.in, err)
+			continue
+		}
+		if got := f.Get(test.key); got != test.want {
+			t.Errorf("%q[%s] -> %q, want %q\n", test.in, test.key, got, test.want)
+		}
+		if string(body) != test.wantBody {
+			t.Errorf("%q body -> %q, want %q\n", test.in, string(body), test.wantBody)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"---\ntitle: missing end\n",
+		"---\ntitle: \"open\n---\n",
+		"---\ntags: [a, b\n---\n",
+		"---\na: 1\na: 2\n---\n",
+		"---\n- not a field\n---\n",
+	}
+	for _, test := range tests {
+		if _, _, err := Parse([]byte(test)); err == nil {
+			t.Errorf("%q expected an error", test)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	f, _, err := Parse([]byte("---\ntags: book, to-read\nlist: [a, 'b']\n---\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.List("tags"), []string{"book", "to-read"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tags -> %q, want %q", got, want)
+	}
+	if got, want := f.List("list"), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("list -> %q, want %q", got, want)
+	}
+	if got := f.List("missing"); got != nil {
+		t.Errorf("missing -> %q, want nil", got)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	in := strings.Join([]string{
+		"---",
+		"# a comment",
+		"title: 'Kept: as is'",
+		"tags:",
+		"- one",
+		"average: 4.1",
+		"---",
+		"# Body",
+		"",
+	}, "\n")
+	f, body, err := Parse([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(Marshal(f, body)); got != in {
+		t.Errorf("unchanged round trip -> %q, want %q", got, in)
+	}
+
+	f.Set("average", "4.2")
+	f.Set("title", "Kept: as is")
+	f.SetList("shelves", []string{"to-read", "a: b"})
+	f.Set("short_title", "Kept")
+	f.Delete("tags")
+	want := strings.Join([]string{
+		"---",
+		"# a comment",
+		"title: 'Kept: as is'",
+		"average: 4.2",
+		"shelves:",
+		"  - to-read",
+		`  - "a: b"`,
+		"short_title: Kept",
+		"---",
+		"# Body",
+		"",
+	}, "\n")
+	if got := string(Marshal(f, body)); got != want {
+		t.Errorf("modified round trip -> %q, want %q", got, want)
+	}
+	if got, want := f.Keys(), []string{"title", "average", "shelves", "short_title"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys() -> %q, want %q", got, want)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{"", `""`},
+		{"Title: Subtitle", `"Title: Subtitle"`},
+		{"It's", `"It's"`},
+		{"[not a list]", `"[not a list]"`},
+		{"a #hash", `"a #hash"`},
+		{`\#1 hit`, `\#1 hit`},
+		{"two\nlines", `"two\nlines"`},
+	}
+	for _, test := range tests {
+		if got := Quote(test.in); got != test.want {
+			t.Errorf("%q -> %s, want %s\n", test.in, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package goodreads
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Importer converts the rows of a book service's export to Books, so any
+// of them can fill the template and update the same notes.
+type Importer interface {
+	// Required are the columns the export must have
+	Required() []string
+	// Book converts a row of the export, an error skips the row
+	Book(row Row) (*Book, error)
+}
+
+// Importers are the services an export can come from, by name
+var Importers = map[string]Importer{
+	"goodreads":    goodreadsImporter{},
+	"storygraph":   storyGraphImporter{},
+	"librarything": libraryThingImporter{},
+}
+
+// importerNames returns the names of the Importers, sorted
+func importerNames() []string {
+	var names []string
+	for name := range Importers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Row is a line of an export, its columns are looked up by name.
+type Row struct {
+	columns map[string]int
+	record  []string
+}
+
+// Get returns the value of the first of names that the export has,
+// or "" if it has none of them.
+func (r Row) Get(names ...string) string {
+	for _, name := range names {
+		if idx, ok := r.columns[normalizeColumn(name)]; ok {
+			if idx < len(r.record) {
+				return r.record[idx]
+			}
+			return ""
+		}
+	}
+	return ""
+}
+
+// rowError is a problem with one row of the export.
+type rowError struct {
+	line int
+	msg  string
+}
+
+// normalizeColumn makes "Book ID", " book_id" and "Book Id" the same.
+func normalizeColumn(name string) string {
+	name = strings.TrimPrefix(name, "\ufeff")
+	name = strings.ReplaceAll(strings.ToLower(name), "_", " ")
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// columnIndexes returns the index of each column in header by its
+// normalized name.
+func columnIndexes(header []string, required []string) (map[string]int, error) {
+	columns := map[string]int{}
+	for i, name := range header {
+		if _, ok := columns[normalizeColumn(name)]; !ok {
+			columns[normalizeColumn(name)] = i
+		}
+	}
+	for _, name := range required {
+		if _, ok := columns[normalizeColumn(name)]; !ok {
+			return nil, fmt.Errorf("no %q column in the header %q", name, header)
+		}
+	}
+	return columns, nil
+}
+
+// parseCSV reads the books from an export, whatever the order and names of
+// its columns. It can be separated by commas or tabs.
+// Rows that can't be used are returned as rowErrors and skipped, the other
+// books are still returned.
+func parseCSV(r io.Reader, imp Importer) ([]*Book, []rowError, error) {
+	br := bufio.NewReader(r)
+	first, err := br.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	reader := csv.NewReader(io.MultiReader(strings.NewReader(first), br))
+	if strings.Count(first, "\t") > strings.Count(first, ",") {
+		reader.Comma = '\t'
+	}
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("empty file")
+	} else if err != nil {
+		return nil, nil, err
+	}
+	columns, err := columnIndexes(header, imp.Required())
+	if err != nil {
+		return nil, nil, err
+	}
+	var books []*Book
+	var rowErrs []rowError
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rowErrs = append(rowErrs, rowError{parseErr.StartLine, parseErr.Err.Error()})
+			continue
+		} else if err != nil {
+			return books, rowErrs, err
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		book, err := imp.Book(Row{columns, record})
+		if err != nil {
+			rowErrs = append(rowErrs, rowError{line, err.Error()})
+			continue
+		}
+		if strings.TrimSpace(book.Title) == "" {
+			rowErrs = append(rowErrs, rowError{line, "no title, skipping"})
+			continue
+		}
+		if len(record) != len(header) {
+			rowErrs = append(rowErrs, rowError{line, fmt.Sprintf("%d columns instead of %d, check %q", len(record), len(header), book.Title)})
+		}
+		if book.AuthorLF == "" {
+			book.AuthorLF = lastFirst(book.Author)
+		}
+		books = append(books, book)
+	}
+	return books, rowErrs, nil
+}
+
+// lastFirst turns "Dan Harris" into "Harris, Dan", for exports without
+// the "Author l-f" column.
+func lastFirst(author string) string {
+	words := strings.Fields(author)
+	if len(words) < 2 || strings.Contains(author, ",") {
+		return author
+	}
+	last := len(words) - 1
+	return words[last] + ", " + strings.Join(words[:last], " ")
+}
+
+// firstLast turns "Harris, Dan" into "Dan Harris".
+func firstLast(author string) string {
+	idx := strings.Index(author, ",")
+	if idx < 0 {
+		return strings.TrimSpace(author)
+	}
+	return strings.TrimSpace(strings.TrimSpace(author[idx+1:]) + " " + author[:idx])
+}
+
+// cleanISBN removes the ="..." that keeps spreadsheets from treating the
+// ISBN as a number, and any spaces or dashes.
+func cleanISBN(isbn string) string {
+	isbn = strings.TrimPrefix(strings.TrimSpace(isbn), "=")
+	isbn = strings.Trim(isbn, `"`)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, isbn)
+}
+
+// splitISBNs returns the 10 and 13 digit ISBNs in isbns, a list separated
+// by commas, spaces or brackets. Other ids, like ASINs, are left out.
+func splitISBNs(isbns string) (isbn, isbn13 string) {
+	for _, s := range strings.FieldsFunc(isbns, func(r rune) bool {
+		return strings.ContainsRune(",; []", r)
+	}) {
+		s = cleanISBN(s)
+		if strings.TrimLeft(strings.TrimSuffix(s, "X"), "0123456789") != "" {
+			continue
+		}
+		switch {
+		case len(s) == 10 && isbn == "":
+			isbn = s
+		case len(s) == 13 && isbn13 == "":
+			isbn13 = s
+		}
+	}
+	return isbn, isbn13
+}
+
+// splitList splits a list separated by commas, dropping empty items.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
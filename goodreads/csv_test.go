@@ -0,0 +1,57 @@
+package goodreads
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCSV(t *testing.T) {
+	export := "\ufeffTitle,Author,book_id,ISBN,Rating,Shelves\n" +
+		"Zero to One,Peter Thiel,18050143,0804139296,5,business\n" +
+		",Nobody,1,,,\n" +
+		"\"Multi\nLine\",Some One,2,=\"\",0\n"
+	books, rowErrs, err := parseCSV(strings.NewReader(export), goodreadsImporter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 2 {
+		t.Fatalf("got %d books, want 2", len(books))
+	}
+	got := books[0]
+	if got.Id != "18050143" || got.ISBN != "0804139296" || got.Rating != "5" ||
+		got.Bookshelves != "business" || got.AuthorLF != "Thiel, Peter" {
+		t.Errorf("first book -> %+v", got)
+	}
+	want := []rowError{{3, "no title, skipping"}, {4, `5 columns instead of 6, check "Multi\nLine"`}}
+	if len(rowErrs) != len(want) {
+		t.Fatalf("row errors -> %v, want %v", rowErrs, want)
+	}
+	for i := range want {
+		if rowErrs[i] != want[i] {
+			t.Errorf("row error %d -> %v, want %v", i, rowErrs[i], want[i])
+		}
+	}
+
+	if _, _, err := parseCSV(strings.NewReader("Book Id,Author\n1,A\n"), goodreadsImporter{}); err == nil {
+		t.Errorf("an export without titles should fail")
+	}
+}
+
+func TestCleanISBN(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`="0151002177"`, "0151002177"},
+		{`=""`, ""},
+		{"", ""},
+		{"978-0-15-100217-7", "9780151002177"},
+		{" 080413929X ", "080413929X"},
+	}
+	for _, test := range tests {
+		got := cleanISBN(test.in)
+		if got != test.want {
+			t.Errorf("%q -> %q, want %q\n", test.in, got, test.want)
+		}
+	}
+}
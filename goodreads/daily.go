@@ -0,0 +1,75 @@
+package goodreads
+
+import (
+	"strings"
+	"time"
+
+	"github.com/scottkirkwood/obsidian/daily"
+)
+
+// dailyRegion is the region of the daily notes with the books
+const dailyRegion = "goodreads"
+
+// dateLayouts are how the services write dates
+var dateLayouts = []string{"2006/01/02", "2006-01-02", "01/02/2006"}
+
+// dailyBook is a book and the days it was read and added, kept from before
+// cleanupBook changes the book.
+type dailyBook struct {
+	book        Book
+	read, added time.Time
+}
+
+// dailyBooks returns the books with a date.
+func dailyBooks(books []*Book) []dailyBook {
+	var ret []dailyBook
+	for _, book := range books {
+		db := dailyBook{book: *book, read: ParseDate(book.DateRead), added: ParseDate(book.DateAdded)}
+		if !db.read.IsZero() || !db.added.IsZero() {
+			ret = append(ret, db)
+		}
+	}
+	return ret
+}
+
+// ParseDate returns the day of txt, a date from any of the Importers, or
+// zero if it isn't one.
+func ParseDate(txt string) time.Time {
+	txt = strings.TrimSpace(txt)
+	if len(txt) > 10 {
+		txt = txt[:10]
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, txt); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// updateDaily lists the books finished and added each day in the daily
+// notes, linked to their notes. LookupExisting must be called first.
+func (c *Conf) updateDaily(books []dailyBook) error {
+	days := daily.Days{}
+	for _, db := range books {
+		link := daily.Link(c.noteFor(db.book), "")
+		if !db.added.IsZero() {
+			days.Add(db.added, "- Added "+link)
+		}
+		if !db.read.IsZero() {
+			days.Add(db.read, "- Finished "+link)
+		}
+	}
+	_, err := c.Daily.Update(dailyRegion, days, c.DryRun)
+	return err
+}
+
+// noteFor returns the note of book, the one it's written to if it's new.
+func (c *Conf) noteFor(book Book) string {
+	title := book.Title
+	c.cleanupBook(&book)
+	if fname, ok := c.findExisting(bookKeys(&book), book.Id); ok {
+		return fname
+	}
+	return c.makeTempFilename(title)
+}
@@ -0,0 +1,31 @@
+package goodreads
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDailyBooks(t *testing.T) {
+	books := []*Book{
+		{Title: "Read", DateRead: "2021/12/05", DateAdded: "2021/01/02"},
+		{Title: "Added", DateAdded: "2021-03-04"},
+		{Title: "Never"},
+	}
+	got := dailyBooks(books)
+	if len(got) != 2 {
+		t.Fatalf("dailyBooks -> %d books, want 2", len(got))
+	}
+	tests := []struct {
+		got, want time.Time
+	}{
+		{got[0].read, time.Date(2021, 12, 5, 0, 0, 0, 0, time.UTC)},
+		{got[0].added, time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{got[1].read, time.Time{}},
+		{got[1].added, time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)},
+	}
+	for i, test := range tests {
+		if !test.got.Equal(test.want) {
+			t.Errorf("%d: %v, want %v", i, test.got, test.want)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package goodreads
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// diffContext is the number of unchanged lines around each change
+	diffContext = 3
+	// ignoredNote follows the hunk header with the changed lines of it
+	// that removeRandomInfo ignores, like "-2 +2" for the old and new
+	// line 2
+	ignoredNote = " ignored %s"
+)
+
+// edit is a line of a diff, op is ' ', '-' or '+'.
+type edit struct {
+	op   byte
+	text string
+}
+
+// PrintDiffs prints a unified diff for each note that would be added or
+// changed. Hunks with changed lines that don't count when comparing notes,
+// like the average rating, list them in their header after ignoredNote.
+func (c *Conf) PrintDiffs(m moveFiles) error {
+	for _, mf := range m {
+		if mf.toFile == "" {
+			continue
+		}
+		diff, err := c.fileDiff(mf)
+		if err != nil {
+			return err
+		}
+		fmt.Print(diff)
+	}
+	return nil
+}
+
+// fileDiff returns the diff from mf.toFile, if it exists, to mf.fromFile
+// or to the merge of the two.
+func (c *Conf) fileDiff(mf moveFile) (string, error) {
+	newBytes, err := os.ReadFile(mf.fromFile)
+	if err != nil {
+		return "", err
+	}
+	newLines := splitLines(string(newBytes))
+	if mf.different {
+		// Show what merging would do instead when it can
+		merged, _, ok, err := c.mergeNote(mf)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			newLines = merged
+		}
+	}
+	fromName, toName := "/dev/null", "b/"+c.relName(mf.toFile)
+	oldBytes, err := os.ReadFile(mf.toFile)
+	if err == nil {
+		fromName = "a/" + c.relName(mf.toFile)
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+	return unifiedDiff(fromName, toName, splitLines(string(oldBytes)), newLines), nil
+}
+
+// relName returns fname relative to the folder notes are searched in
+func (c *Conf) relName(fname string) string {
+	rel, err := filepath.Rel(c.searchDir(), fname)
+	if err != nil {
+		return fname
+	}
+	return rel
+}
+
+func splitLines(txt string) []string {
+	if txt == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(txt, "\n"), "\n")
+}
+
+// isRandomLine is true for the lines removeRandomInfo removes
+func isRandomLine(line string) bool {
+	return ratingRx.MatchString(line) || pagesRx.MatchString(line)
+}
+
+// unifiedDiff returns the changes from a to b in the unified format,
+// or "" if they're the same.
+func unifiedDiff(fromName, toName string, a, b []string) string {
+	edits := diffLines(a, b)
+	var changes []int
+	for i, e := range edits {
+		if e.op != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+	for first := 0; first < len(changes); {
+		last := first
+		for last+1 < len(changes) && changes[last+1]-changes[last] <= 2*diffContext {
+			last++
+		}
+		start, end := changes[first]-diffContext, changes[last]+diffContext+1
+		if start < 0 {
+			start = 0
+		}
+		if end > len(edits) {
+			end = len(edits)
+		}
+		aStart, bStart := countLines(edits[:start])
+		aCount, bCount := countLines(edits[start:end])
+		fmt.Fprintf(&out, "@@ -%s +%s @@", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+		if ignored := ignoredLines(edits[start:end], aStart, bStart); len(ignored) > 0 {
+			fmt.Fprintf(&out, ignoredNote, strings.Join(ignored, " "))
+		}
+		out.WriteByte('\n')
+		for _, e := range edits[start:end] {
+			out.WriteByte(e.op)
+			out.WriteString(e.text)
+			out.WriteByte('\n')
+		}
+		first = last + 1
+	}
+	return out.String()
+}
+
+// ignoredLines returns the changed lines of edits that are ignored, as
+// -N for line N of a and +N for line N of b, after aStart and bStart
+// lines of them.
+func ignoredLines(edits []edit, aStart, bStart int) []string {
+	var ret []string
+	a, b := aStart, bStart
+	for _, e := range edits {
+		if e.op != '+' {
+			a++
+		}
+		if e.op != '-' {
+			b++
+		}
+		if e.op == ' ' || !isRandomLine(e.text) {
+			continue
+		}
+		if e.op == '-' {
+			ret = append(ret, fmt.Sprintf("-%d", a))
+		} else {
+			ret = append(ret, fmt.Sprintf("+%d", b))
+		}
+	}
+	return ret
+}
+
+// countLines returns how many lines of a and of b the edits cover.
+func countLines(edits []edit) (a, b int) {
+	for _, e := range edits {
+		if e.op != '+' {
+			a++
+		}
+		if e.op != '-' {
+			b++
+		}
+	}
+	return a, b
+}
+
+// hunkRange formats the start and length of a hunk, start being the
+// number of lines before it.
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", before+1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
+
+// diffLines returns the shortest edits turning a into b, using the
+// longest common subsequence of lines.
+func diffLines(a, b []string) []edit {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	edits := make([]edit, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i]})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{'-', a[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j]})
+			j++
+		}
+	}
+	return edits
+}
@@ -0,0 +1,68 @@
+package goodreads
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		a, b, want string
+	}{
+		{"a\nb", "a\nb", ""},
+		{"", "a\nb", "--- x\n+++ y\n@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"a\nb\nc", "a\nB\nc", "--- x\n+++ y\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"},
+		{
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12",
+			"0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11",
+			"--- x\n+++ y\n@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n@@ -9,4 +10,3 @@\n 9\n 10\n 11\n-12\n",
+		},
+		{
+			"title: A\naverage: 3.91",
+			"title: A\naverage: 3.92",
+			"--- x\n+++ y\n@@ -1,2 +1,2 @@ ignored -2 +2\n title: A\n-average: 3.91\n+average: 3.92\n",
+		},
+		{
+			"title: A\npages: 10\naverage: 3.91\nrating: 4",
+			"title: B\naverage: 3.92\nrating: 4",
+			"--- x\n+++ y\n@@ -1,4 +1,3 @@ ignored -2 -3 +2\n-title: A\n-pages: 10\n-average: 3.91\n+title: B\n+average: 3.92\n rating: 4\n",
+		},
+	}
+	for _, test := range tests {
+		got := unifiedDiff("x", "y", splitLines(test.a), splitLines(test.b))
+		if got != test.want {
+			t.Errorf("%q, %q -> %q, want %q\n", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestFileDiff(t *testing.T) {
+	tmpDir, outDir := t.TempDir(), t.TempDir()
+	c := NewConf("", outDir, "")
+	write := func(fname, txt string) string {
+		if err := os.WriteFile(fname, []byte(txt), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return fname
+	}
+	newFile := write(filepath.Join(tmpDir, "New.md"), "# New\n")
+	got, err := c.fileDiff(moveFile{fromFile: newFile, toFile: filepath.Join(outDir, "New.md")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "--- /dev/null\n+++ b/New.md\n@@ -0,0 +1 @@\n+# New\n"; got != want {
+		t.Errorf("new file -> %q, want %q", got, want)
+	}
+
+	changed := write(filepath.Join(tmpDir, "Old.md"), "# Old\nrating: 5\n")
+	existing := write(filepath.Join(outDir, "Old name.md"), "# Old\nrating: 4\n")
+	got, err = c.fileDiff(moveFile{fromFile: changed, toFile: existing, different: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(got, "--- a/Old name.md\n+++ b/Old name.md\n") || !strings.Contains(got, "-rating: 4\n+rating: 5\n") {
+		t.Errorf("changed file -> %q", got)
+	}
+}
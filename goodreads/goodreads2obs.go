@@ -1,60 +1,127 @@
-// goodreads 2 obsidian converter
-package main
+// Package goodreads converts a goodreads export to obsidian notes.
+package goodreads
 
 import (
 	"bytes"
-	"flag"
+	_ "embed"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"sort"
 	"strings"
 	"text/template"
 
-	"github.com/gocarina/gocsv"
+	"github.com/scottkirkwood/obsidian/config"
+	"github.com/scottkirkwood/obsidian/daily"
+	"github.com/scottkirkwood/obsidian/frontmatter"
+	"github.com/scottkirkwood/obsidian/region"
 )
 
-var (
-	dirFlag          = flag.String("dir", "~/zk/Zettelkasten/books", "Folder to place .md files")
-	inFileFlag       = flag.String("in", "goodreads.csv", "File containing goodreads info in csv format")
-	templateFileFlag = flag.String("template", "book-template.md", "Template to use")
-)
+// regionName marks the part of a note that's generated, see region
+const regionName = "goodreads"
+
+// defaultTemplate is used when there's no template file
+//
+//go:embed book-template.md
+var defaultTemplate string
 
 // Conf is the configurations information for this tool
 type Conf struct {
 	inputFile    string
 	outputDir    string
-	templateFile string
+	templateFile string // Empty for defaultTemplate
+
+	// DryRun shows what would change without touching outputDir
+	DryRun bool
+
+	// Tags maps a shelf to the tag to use instead, an empty tag drops it
+	Tags map[string]string
+
+	// Update only sets the frontmatter keys the importer owns in notes
+	// that exist, see UpdateNotes
+	Update bool
+
+	// StateDir keeps the notes as last generated, to merge with the
+	// changes made in the vault since
+	StateDir string
+
+	// Source is the name of the Importer for inputFile, empty for goodreads
+	Source string
+
+	// Daily, if set, gets the books read and added each day listed in
+	// the daily notes
+	Daily *daily.Conf
+
+	// VaultDir is searched, with its subfolders, for notes that were
+	// renamed or moved out of outputDir. Empty only searches outputDir.
+	VaultDir string
 
 	tempDir string
-	books   []*GoodReadCols
+	books   []*Book
 
-	// Key is either isbn, raw title, or filename
-	// value is the filename
+	// Key is one of the identityKeys of a note, value is the filename
 	existing map[string]string
+	// existingIDs is the goodreads id of each note, if it has one
+	existingIDs map[string]string
+	// filenames are the files in tempDir of the books, see tempFilename
+	filenames map[*Book]string
+	// claimed is the book each note is being updated from
+	claimed map[string]string
 }
 
-func newConf(inputFile, outputDir, templateFile string) *Conf {
-	outputDir = strings.ReplaceAll(outputDir, "~", "$HOME")
-	outputDir = os.ExpandEnv(outputDir)
+func NewConf(inputFile, outputDir, templateFile string) *Conf {
+	outputDir = config.ExpandPath(outputDir)
 	return &Conf{
 		inputFile:    inputFile,
 		outputDir:    outputDir,
 		templateFile: templateFile,
 		tempDir:      filepath.Join(os.TempDir(), "goodreads"),
+		Tags:         map[string]string{},
+		StateDir:     filepath.Join(outputDir, ".goodreads"),
 	}
 }
 
+// DefaultInput is the export file in the current folder
+const DefaultInput = "goodreads.csv"
+
+// FromConfig returns the Conf for the [goodreads] settings of conf.
+func FromConfig(conf *config.Config) *Conf {
+	inFile := DefaultInput
+	if conf.Goodreads.Input != "" {
+		inFile = conf.Path(conf.Goodreads.Input)
+	}
+	c := NewConf(inFile, conf.GoodreadsDir(), conf.Path(conf.Goodreads.Template))
+	c.Update = conf.Goodreads.Update
+	c.VaultDir = conf.VaultDir()
+	c.Source = conf.Goodreads.Source
+	if conf.Goodreads.Daily {
+		c.Daily = daily.FromConfig(conf)
+	}
+	if conf.Goodreads.State != "" {
+		c.StateDir = conf.Path(conf.Goodreads.State)
+	}
+	for shelf, tag := range conf.Goodreads.Tags {
+		c.Tags[shelf] = tag
+	}
+	return c
+}
+
 type moveFile struct {
 	fromFile  string
 	toFile    string // If empty, we delete fromFile
 	different bool   // Found both and they are different
+	existing  string // The identical note in the vault, when toFile is empty
 }
 
 type moveFiles []moveFile
 
-type GoodReadCols struct {
+// Book is a book from any of the Importers, its fields are what the
+// template can use. The csv tags are the columns of the Goodreads export.
+type Book struct {
 	Id                       string `csv:"Book Id"`
 	Title                    string `csv:"Title"`
 	Author                   string `csv:"Author"`
@@ -91,24 +158,68 @@ type GoodReadCols struct {
 	YamlTags string
 }
 
-func (c *Conf) ReadCSV() ([]*GoodReadCols, error) {
+// columnAliases are other names the columns in the csv tags of Book had
+// in older Goodreads exports, or have in newer ones.
+var columnAliases = map[string][]string{
+	"Book Id":         {"Id"},
+	"Author l-f":      {"Author LF"},
+	"My Rating":       {"Rating"},
+	"Number of Pages": {"Pages", "Num Pages"},
+	"Date Read":       {"Read At"},
+	"Date Added":      {"Added"},
+	"Bookshelves":     {"Shelves"},
+	"Exclusive Shelf": {"Shelf"},
+	"My Review":       {"Review"},
+}
+
+// goodreadsImporter reads the Goodreads export, by the csv tags of Book
+type goodreadsImporter struct{}
+
+func (goodreadsImporter) Required() []string {
+	return []string{"Title"}
+}
+
+func (goodreadsImporter) Book(row Row) (*Book, error) {
+	book := &Book{}
+	val := reflect.ValueOf(book).Elem()
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		tag := typ.Field(i).Tag.Get("csv")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		val.Field(i).SetString(row.Get(append([]string{tag}, columnAliases[tag]...)...))
+	}
+	return book, nil
+}
+
+func (c *Conf) ReadCSV() ([]*Book, error) {
 	f, err := os.Open(c.inputFile)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
-	books := []*GoodReadCols{}
-
-	if err := gocsv.UnmarshalFile(f, &books); err != nil {
-		return books, err
+	source := c.Source
+	if source == "" {
+		source = "goodreads"
+	}
+	imp, ok := Importers[source]
+	if !ok {
+		return nil, fmt.Errorf("unknown source %q, use one of %q", source, importerNames())
+	}
+	books, rowErrs, err := parseCSV(f, imp)
+	if err != nil {
+		return books, fmt.Errorf("%s: %v", c.inputFile, err)
+	}
+	for _, rowErr := range rowErrs {
+		fmt.Printf("%s:%d: %s\n", c.inputFile, rowErr.line, rowErr.msg)
 	}
 	c.books = books
 	return books, nil
 }
 
-func (c *Conf) writeBook(t *template.Template, book *GoodReadCols) error {
-	fname := c.makeTempFilename(book.Title)
-	cleanupBook(book)
+func (c *Conf) writeBook(t *template.Template, fname string, book *Book) error {
+	c.cleanupBook(book)
 	if err := makeDirs(fname); err != nil {
 		return err
 	}
@@ -145,10 +256,10 @@ func (c *Conf) makeTempFilename(fname string) string {
 	return filepath.Join(c.tempDir, fname+".md")
 }
 
-func cleanupBook(book *GoodReadCols) {
+func (c *Conf) cleanupBook(book *Book) {
 	book.Title = strings.ReplaceAll(book.Title, "#", `\#`)
-	book.ISBN = strings.Trim(book.ISBN[1:], `"`)
-	book.ISBN13 = strings.Trim(book.ISBN13[1:], `"`)
+	book.ISBN = cleanISBN(book.ISBN)
+	book.ISBN13 = cleanISBN(book.ISBN13)
 	if book.Rating == "0" {
 		book.Rating = ""
 	}
@@ -156,43 +267,42 @@ func cleanupBook(book *GoodReadCols) {
 		book.DateRead = book.DateAdded
 	}
 	book.DateRead = strings.Replace(book.DateRead, "/", "-", -1)
+	book.Review = reviewMarkdown(book.Review, book.Spoiler == "true")
+	book.PrivateNotes = htmlToMarkdown(book.PrivateNotes)
 
-	book.YamlTags = makeYamlTags(book)
-}
-
-func makeYamlTags(book *GoodReadCols) string {
-	m := map[string]string{}
-	m["short_title"] = shortTitle(book.Title)
-	m["title"] = book.Title
-	m["author"] = book.AuthorLF
-	m["isbn"] = book.ISBN
-	m["date_read"] = book.DateRead
-	m["average"] = book.Average
-	m["tags"] = strings.Join(makeTags(book), ", ")
-	keyOrder := []string{
-		"short_title", "title", "author", "isbn", "date_read", "average", "tags",
-	}
-	return strings.Join(kvToLines(m, keyOrder), "\n")
+	book.YamlTags = c.makeYamlTags(book)
 }
 
-// kvToLines takes a string-string maps and makes it a key: value
-// It skips empty values and
-func kvToLines(kv map[string]string, keys []string) []string {
-	lines := make([]string, 0, len(kv))
-	for _, key := range keys {
-		val := kv[key]
-		if val == "" {
-			continue
+func (c *Conf) makeYamlTags(book *Book) string {
+	fm := frontmatter.New()
+	fields := []struct{ key, val string }{
+		{"short_title", shortTitle(book.Title)},
+		{"title", book.Title},
+		{"author", book.AuthorLF},
+		{idKey, book.Id},
+		{"isbn", book.ISBN},
+		{"isbn13", book.ISBN13},
+		{"date_read", book.DateRead},
+		{"rating", book.Rating},
+		{"average", book.Average},
+		{"tags", strings.Join(c.makeTags(book), ", ")},
+	}
+	for _, kv := range fields {
+		// Skip empty values
+		if kv.val != "" {
+			fm.Set(kv.key, kv.val)
 		}
-		lines = append(lines, fmt.Sprintf("%s: %s", key, maybeQuote(val)))
 	}
-	return lines
+	return fm.String()
 }
 
-func makeTags(book *GoodReadCols) []string {
+func (c *Conf) makeTags(book *Book) []string {
 	tags := []string{"book"}
 	for _, bookshelf := range strings.Split(book.Bookshelves, ",") {
 		tag := strings.TrimSpace(bookshelf)
+		if mapped, ok := c.Tags[tag]; ok {
+			tag = mapped
+		}
 		if tag != "" {
 			tags = append(tags, tag)
 		}
@@ -200,71 +310,148 @@ func makeTags(book *GoodReadCols) []string {
 	return tags
 }
 
-func maybeQuote(val string) string {
-	if strings.ContainsAny(val, `':`) {
-		return fmt.Sprintf("%q", val)
-	}
-	return val
-}
-
 func shortTitle(title string) string {
 	return strings.Split(title, ":")[0]
 }
 
 func (c *Conf) WriteBooks() error {
-	t, err := template.ParseFiles(c.templateFile)
+	t, err := c.parseTemplate()
 	if err != nil {
 		return err
 	}
 	fmt.Printf("Temporary output to %s\n", c.tempDir)
+	// Leftovers from the last run would be compared again
+	if err := os.RemoveAll(c.tempDir); err != nil {
+		return err
+	}
 	for _, book := range c.books {
-		if err := c.writeBook(t, book); err != nil {
+		if err := c.writeBook(t, c.tempFilename(book), book); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// tempFilename is the file in tempDir of book. The files of all the books
+// read are named the first time, so a book keeps its name when UpdateNotes
+// leaves only the new ones.
+func (c *Conf) tempFilename(book *Book) string {
+	if fname, ok := c.filenames[book]; ok {
+		return fname
+	}
+	// Editions of a book have different IDs but the same name
+	c.filenames = map[*Book]string{}
+	taken := map[string]bool{}
+	for _, b := range append(append([]*Book(nil), c.books...), book) {
+		if _, ok := c.filenames[b]; ok {
+			continue
+		}
+		fname := c.makeTempFilename(b.Title)
+		if taken[fname] {
+			unique := uniqueFilename(fname, b.Id, taken)
+			fmt.Printf("%q has the name of another book, writing it to %q\n", b.Title, filepath.Base(unique))
+			fname = unique
+		}
+		taken[fname] = true
+		c.filenames[b] = fname
+	}
+	return c.filenames[book]
+}
+
+// uniqueFilename is fname with id, or else a number, added so it isn't
+// one of taken.
+func uniqueFilename(fname, id string, taken map[string]bool) string {
+	base := strings.TrimSuffix(fname, ".md")
+	if unique := base + " " + id + ".md"; id != "" && !taken[unique] {
+		return unique
+	}
+	for n := 2; ; n++ {
+		if unique := fmt.Sprintf("%s %d.md", base, n); !taken[unique] {
+			return unique
+		}
+	}
+}
+
+func (c *Conf) parseTemplate() (*template.Template, error) {
+	if c.templateFile == "" {
+		return template.New("book-template.md").Parse(defaultTemplate)
+	}
+	return template.ParseFiles(c.templateFile)
+}
+
 func (c *Conf) LookupExisting() error {
 	c.existing = map[string]string{}
-	glob := filepath.Join(c.outputDir, "*.md")
-	files, err := filepath.Glob(glob)
+	c.existingIDs = map[string]string{}
+	c.claimed = map[string]string{}
+	files, err := c.noteFiles()
 	if err != nil {
 		return err
 	}
 	if len(files) == 0 {
-		fmt.Printf("Note: no files found for %q\n", glob)
+		fmt.Printf("Note: no notes found in %q\n", c.searchDir())
 	}
 	for _, fname := range files {
-		fields, err := readMdFile(fname)
+		fields, _, err := frontmatter.ReadFile(fname)
 		if err != nil {
 			fmt.Printf("Unable to read %s, %v\n", fname, err)
 			continue
 		}
-		isbn := getISBNOrEquivalent(fields, filepath.Base(fname))
-		if c.existing[isbn] != "" {
-			return fmt.Errorf("duplicate isbn %s", isbn)
+		// Elsewhere in the vault only book notes count
+		if filepath.Dir(fname) != filepath.Clean(c.outputDir) && !isBookNote(fields) {
+			continue
 		}
-		c.existing[isbn] = fname
+		c.addExisting(fname, fields.Get(idKey), identityKeys(fields, filepath.Base(fname)))
 	}
 	return nil
 }
 
-func getISBNOrEquivalent(fields map[string]string, baseName string) string {
-	isbn, ok := fields["isbn"]
-	if !ok {
-		title, ok := fields["title"]
-		if !ok {
-			return baseName
+// searchDir is the folder LookupExisting searches
+func (c *Conf) searchDir() string {
+	if c.VaultDir == "" {
+		return c.outputDir
+	}
+	return c.VaultDir
+}
+
+// noteFiles returns the notes in outputDir and, recursively, the ones in
+// VaultDir. Hidden folders, like .obsidian and the StateDir, are skipped.
+func (c *Conf) noteFiles() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(c.outputDir, "*.md"))
+	if err != nil || c.VaultDir == "" {
+		return files, err
+	}
+	seen := map[string]bool{}
+	for _, fname := range files {
+		seen[fname] = true
+	}
+	err = filepath.WalkDir(c.VaultDir, func(path string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) && path == c.VaultDir {
+			return nil
+		} else if err != nil {
+			return err
 		}
-		return title
+		if d.IsDir() {
+			if path != c.VaultDir && (strings.HasPrefix(d.Name(), ".") || path == c.StateDir || path == c.tempDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) == ".md" && !seen[path] {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// isBookNote is true if the frontmatter has a key that identifies a book.
+func isBookNote(fields *frontmatter.Frontmatter) bool {
+	if fields.Get(idKey) != "" || fields.Get("isbn13") != "" || fields.Get("isbn") != "" {
+		return true
 	}
-	return isbn
+	return fields.Get("title") != "" && fields.Get("author") != ""
 }
 
-// CompareDirs compares the tempDir with outputDir
-// It returns a list of moveFile it things are required
-// to make them the same
 func (c *Conf) CompareDirs() (moveFiles, error) {
 	ret := moveFiles{}
 
@@ -274,32 +461,52 @@ func (c *Conf) CompareDirs() (moveFiles, error) {
 		return ret, err
 	}
 	for _, tmpFile := range tmpFiles {
-		fields, err := readMdFile(tmpFile)
+		fields, _, err := frontmatter.ReadFile(tmpFile)
 		if err != nil {
 			fmt.Printf("Unable to read %q: %v\n", tmpFile, err)
 			continue
 		}
 		newBasename := filepath.Base(tmpFile)
-		isbn := getISBNOrEquivalent(fields, newBasename)
-		existingName, ok := c.existing[isbn]
-		if !ok {
-			// it's a new file
+		existingName, ok := c.findExisting(identityKeys(fields, newBasename), fields.Get(idKey))
+		if ok && !c.claim(existingName, tmpFile) {
 			ret = append(ret, moveFile{
 				fromFile: tmpFile,
-				toFile:   filepath.Join(c.outputDir, newBasename),
+			})
+			continue
+		}
+		if !ok {
+			// it's a new file, unless one we couldn't read has its name
+			toFile := filepath.Join(c.outputDir, newBasename)
+			if _, known := c.existingIDs[toFile]; known {
+				fmt.Printf("%q is the note of another book, skipping %q\n", toFile, fields.Get("title"))
+				ret = append(ret, moveFile{
+					fromFile: tmpFile,
+				})
+				continue
+			}
+			_, err := os.Stat(toFile)
+			ret = append(ret, moveFile{
+				fromFile:  tmpFile,
+				toFile:    toFile,
+				different: err == nil,
 			})
 		} else {
+			spliced, err := c.spliceRegion(tmpFile, existingName)
+			if err != nil {
+				fmt.Printf("Error updating the region of %q: %v\n", existingName, err)
+				continue
+			}
 			equal, err := mdFilesEquivalent(tmpFile, existingName)
 			if err != nil {
 				fmt.Printf("Error comparing files %q ?= %q: %v\n", tmpFile, existingName, err)
 				continue
 			}
 			if !equal {
-				// They are different overwrite
+				// They are different, a spliced one only changed in its region
 				ret = append(ret, moveFile{
 					fromFile:  tmpFile,
 					toFile:    existingName,
-					different: true,
+					different: !spliced,
 				})
 			} else if filepath.Base(existingName) != newBasename {
 				// They are identical, but have different names
@@ -311,6 +518,7 @@ func (c *Conf) CompareDirs() (moveFiles, error) {
 				// Remove source file
 				ret = append(ret, moveFile{
 					fromFile: tmpFile,
+					existing: existingName,
 				})
 			}
 		}
@@ -318,19 +526,85 @@ func (c *Conf) CompareDirs() (moveFiles, error) {
 	return ret, nil
 }
 
+// spliceRegion rewrites tmpFile as existingFile with its goodreads region
+// and the frontmatter keys the importer owns replaced by those in tmpFile,
+// leaving the rest of the note as it is.
+// It returns false if either doesn't have the region.
+func (c *Conf) spliceRegion(tmpFile, existingFile string) (bool, error) {
+	newBytes, err := os.ReadFile(tmpFile)
+	if err != nil {
+		return false, err
+	}
+	content, ok := region.Get(splitLines(string(newBytes)), regionName)
+	if !ok {
+		return false, nil
+	}
+	oldBytes, err := os.ReadFile(existingFile)
+	if err != nil {
+		return false, err
+	}
+	lines, ok := region.Replace(splitLines(string(oldBytes)), regionName, content)
+	if !ok {
+		return false, nil
+	}
+	txt := strings.Join(lines, "\n")
+	if bytes.HasSuffix(oldBytes, []byte("\n")) {
+		txt += "\n"
+	}
+	data := []byte(txt)
+	newFields, _, err := frontmatter.Parse(newBytes)
+	if err != nil {
+		return false, err
+	}
+	fields, body, err := frontmatter.Parse(data)
+	if err != nil {
+		return false, err
+	}
+	if len(c.setOwned(fields, c.noteOwnedFields(newFields))) > 0 {
+		data = frontmatter.Marshal(fields, body)
+	}
+	return true, os.WriteFile(tmpFile, data, 0644)
+}
+
 // mdFilesEquivalent returns true if they are mostly the same
 func mdFilesEquivalent(tmpFile, existingFile string) (bool, error) {
 	newBytes, err := os.ReadFile(tmpFile)
 	if err != nil {
 		return true, err
 	}
-	newBytes = removeRandomInfo(newBytes)
+	// The kindle import writes notes without a final newline
+	newBytes = bytes.TrimRight(removeRandomInfo(newBytes), "\n")
 	oldBytes, err := os.ReadFile(existingFile)
 	if err != nil {
 		return true, err
 	}
-	oldBytes = removeRandomInfo(oldBytes)
-	return bytes.Equal(newBytes, oldBytes), nil
+	oldBytes = bytes.TrimRight(removeRandomInfo(oldBytes), "\n")
+	return bytes.Equal(newBytes, oldBytes) || sameFields(newBytes, oldBytes), nil
+}
+
+// sameFields returns true if the notes have the same body and frontmatter
+// values, in any order, so keys added by UpdateNotes don't count.
+func sameFields(a, b []byte) bool {
+	fieldsA, bodyA, err := frontmatter.Parse(a)
+	if err != nil {
+		return false
+	}
+	fieldsB, bodyB, err := frontmatter.Parse(b)
+	if err != nil || !bytes.Equal(bodyA, bodyB) {
+		return false
+	}
+	keysA, keysB := fieldsA.Keys(), fieldsB.Keys()
+	sort.Strings(keysA)
+	sort.Strings(keysB)
+	if !equalLines(keysA, keysB) {
+		return false
+	}
+	for _, key := range keysA {
+		if fieldsA.Get(key) != fieldsB.Get(key) {
+			return false
+		}
+	}
+	return true
 }
 
 var (
@@ -344,30 +618,31 @@ func removeRandomInfo(bytes []byte) []byte {
 	return pagesRx.ReplaceAll(ratingRx.ReplaceAll(bytes, []byte{}), []byte{})
 }
 
-func (c *Conf) Summary(m moveFiles) {
-	deleteFileCount, moveFileCount, diffFileCount := 0, 0, 0
+// Summary prints how many notes are copied, and how many of those that
+// differ from the vault are still unmerged or in conflict after
+// MergeDifferent, which returns unresolved.
+func (c *Conf) Summary(m moveFiles, unresolved int) {
+	deleteFileCount, moveFileCount := 0, 0
 	for _, mf := range m {
 		if mf.toFile == "" {
 			deleteFileCount++
-		} else if mf.different {
-			diffFileCount++
-		} else {
+		} else if !mf.different {
 			moveFileCount++
 		}
 	}
+	diffFileCount := unresolved
 	if moveFileCount+diffFileCount == 0 {
 		fmt.Printf("Directories are identical\n")
 	} else {
 		if moveFileCount > 0 {
-			fmt.Printf("Copying %d files\n", moveFileCount)
+			if c.DryRun {
+				fmt.Printf("Would copy %d files\n", moveFileCount)
+			} else {
+				fmt.Printf("Copying %d files\n", moveFileCount)
+			}
 		}
 		if diffFileCount > 0 {
 			fmt.Printf("Found %d differences\n", diffFileCount)
-			for _, mf := range m {
-				if mf.different {
-					fmt.Printf("meld %q %q\n", mf.fromFile, mf.toFile)
-				}
-			}
 		}
 	}
 }
@@ -419,63 +694,63 @@ func crossDeviceMove(from, to string) error {
 	return os.Remove(from)
 }
 
-var (
-	keyString = regexp.MustCompile(`([^:]+): "(.*)"`)
-	keyVal    = regexp.MustCompile(`([^:]+): (.*)`)
-)
-
-func readMdFile(fname string) (map[string]string, error) {
-	fields := make(map[string]string)
-	bytes, err := os.ReadFile(fname)
-	if err != nil {
-		return fields, err
-	}
-	lines := strings.Split(string(bytes), "\n")
-	for _, line := range lines {
-		matches := keyString.FindStringSubmatch(line)
-		if len(matches) == 3 {
-			fields[matches[1]] = matches[2]
-			continue
-		}
-		matches = keyVal.FindStringSubmatch(line)
-		if len(matches) == 3 {
-			fields[matches[1]] = matches[2]
-		}
-	}
-	return fields, nil
-}
-
-func main() {
-	flag.Parse()
-
-	c := newConf(*inFileFlag, *dirFlag, *templateFileFlag)
+// Import converts the csv file and moves the new and renamed notes
+// into outputDir.
+func (c *Conf) Import() error {
 	fmt.Printf("Goodreads Converter\n")
 	books, err := c.ReadCSV()
 	if err != nil {
-		fmt.Printf("Error reading file %v\n", err)
-		return
+		return fmt.Errorf("reading file %v", err)
 	}
 	fmt.Printf("NumBooks %d\n", len(books))
+	days := dailyBooks(books)
+	if c.Update {
+		if err := c.LookupExisting(); err != nil {
+			return fmt.Errorf("comparing %v", err)
+		}
+		if err := c.UpdateNotes(); err != nil {
+			return fmt.Errorf("updating %v", err)
+		}
+	}
 	if err := c.WriteBooks(); err != nil {
-		fmt.Printf("Error formatting books %v\n", err)
-		return
+		return fmt.Errorf("formatting books %v", err)
 	}
 	if err := c.LookupExisting(); err != nil {
-		fmt.Printf("Error comparing %v\n", err)
-		return
+		return fmt.Errorf("comparing %v", err)
 	}
 	moveFiles, err := c.CompareDirs()
 	if err != nil {
-		fmt.Printf("Error comparing %v\n", err)
-		return
+		return fmt.Errorf("comparing %v", err)
+	}
+	if c.Daily != nil {
+		if err := c.updateDaily(days); err != nil {
+			return fmt.Errorf("daily notes %v", err)
+		}
 	}
-	c.Summary(moveFiles)
+	if c.DryRun {
+		if err := c.PrintDiffs(moveFiles); err != nil {
+			return fmt.Errorf("diffing %v", err)
+		}
+		unresolved, err := c.MergeDifferent(moveFiles)
+		if err != nil {
+			return fmt.Errorf("merging %v", err)
+		}
+		c.Summary(moveFiles, unresolved)
+		return os.RemoveAll(c.tempDir)
+	}
+	if err := c.SaveState(moveFiles); err != nil {
+		return fmt.Errorf("saving state %v", err)
+	}
+	unresolved, err := c.MergeDifferent(moveFiles)
+	if err != nil {
+		return fmt.Errorf("merging %v", err)
+	}
+	c.Summary(moveFiles, unresolved)
 	if err := moveFiles.DeleteTempfiles(); err != nil {
-		fmt.Printf("Unable to delete %v\n", err)
-		return
+		return fmt.Errorf("unable to delete %v", err)
 	}
 	if err := moveFiles.MoveTempFiles(); err != nil {
-		fmt.Printf("Unable to mv file %v\n", err)
-		return
+		return fmt.Errorf("unable to mv file %v", err)
 	}
+	return nil
 }
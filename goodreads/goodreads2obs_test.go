@@ -1,8 +1,13 @@
-package main
+package goodreads
 
 import (
 	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/scottkirkwood/obsidian/frontmatter"
 )
 
 func TestRemoveRandom(t *testing.T) {
@@ -16,10 +21,109 @@ func TestRemoveRandom(t *testing.T) {
 		{"average: 3.45\npages: 123\n", "\n\n"},
 	}
 	for _, test := range tests {
-		got := removeRandom([]byte(test.in))
+		got := removeRandomInfo([]byte(test.in))
 
 		if !bytes.Equal(got, []byte(test.want)) {
 			t.Errorf("%q -> %q, want %q\n", string(test.in), string(got), string(test.want))
 		}
 	}
 }
+
+func TestMakeTags(t *testing.T) {
+	c := NewConf("", "", "")
+	c.Tags = map[string]string{"audio-book": "audiobook", "to-read": ""}
+	tests := []struct {
+		in, want string
+	}{
+		{"", "book"},
+		{"fiction, audio-book", "book, fiction, audiobook"},
+		{"to-read", "book"},
+	}
+	for _, test := range tests {
+		got := strings.Join(c.makeTags(&Book{Bookshelves: test.in}), ", ")
+		if got != test.want {
+			t.Errorf("%q -> %q, want %q\n", test.in, got, test.want)
+		}
+	}
+}
+
+func TestSpliceRegion(t *testing.T) {
+	dir := t.TempDir()
+	tmpFile, existing := filepath.Join(dir, "tmp.md"), filepath.Join(dir, "Book.md")
+	tests := []struct {
+		name, gen, old, want string
+		spliced              bool
+	}{
+		{
+			"region",
+			"---\ntitle: B\n---\n%% begin goodreads %%\nnew\n%% end goodreads %%\n",
+			"---\ntitle: Mine\n---\n# Notes\n%% begin goodreads %%\nold\n%% end goodreads %%\nMore notes\n",
+			"---\ntitle: Mine\n---\n# Notes\n%% begin goodreads %%\nnew\n%% end goodreads %%\nMore notes\n",
+			true,
+		},
+		{
+			"owned keys",
+			"---\ntitle: B\nrating: 5\ndate_read: 2023-01-02\ntags: book, fiction\n---\n%% begin goodreads %%\nnew\n%% end goodreads %%\n",
+			"---\ntitle: Mine\nrating: 4\nmine: kept\ntags: [book]\n---\n%% begin goodreads %%\nold\n%% end goodreads %%\nMore notes\n",
+			"---\ntitle: Mine\nrating: 5\nmine: kept\ntags:\n  - book\n  - fiction\ndate_read: 2023-01-02\n---\n%% begin goodreads %%\nnew\n%% end goodreads %%\nMore notes\n",
+			true,
+		},
+		{"no region in note", "%% begin goodreads %%\nnew\n%% end goodreads %%\n", "old\n", "", false},
+		{"no region in template", "new\n", "%% begin goodreads %%\nold\n%% end goodreads %%\n", "", false},
+	}
+	for _, test := range tests {
+		if err := os.WriteFile(tmpFile, []byte(test.gen), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(existing, []byte(test.old), 0644); err != nil {
+			t.Fatal(err)
+		}
+		spliced, err := NewConf("", dir, "").spliceRegion(tmpFile, existing)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(tmpFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := test.want
+		if !spliced {
+			want = test.gen
+		}
+		if spliced != test.spliced || string(got) != want {
+			t.Errorf("%s -> %v, %q, want %v, %q\n", test.name, spliced, got, test.spliced, want)
+		}
+	}
+}
+
+func TestWriteBooks(t *testing.T) {
+	c := NewConf("", t.TempDir(), "")
+	c.tempDir = t.TempDir()
+	c.books = []*Book{
+		{Id: "1", Title: "Fahrenheit 451"},
+		{Id: "2", Title: "Fahrenheit 451"},
+		{Title: "Fahrenheit 451"},
+		{Id: "4", Title: "Meditations"},
+	}
+	if err := c.WriteBooks(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, id string
+	}{
+		{"Fahrenheit 451.md", "1"},
+		{"Fahrenheit 451 2.md", "2"},
+		{"Fahrenheit 451 3.md", ""},
+		{"Meditations.md", "4"},
+	}
+	for _, test := range tests {
+		fields, _, err := frontmatter.ReadFile(filepath.Join(c.tempDir, test.name))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := fields.Get(idKey); got != test.id {
+			t.Errorf("%s %s = %q, want %q", test.name, idKey, got, test.id)
+		}
+	}
+}
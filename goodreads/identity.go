@@ -0,0 +1,88 @@
+package goodreads
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/scottkirkwood/obsidian/frontmatter"
+	"github.com/scottkirkwood/obsidian/normalize"
+)
+
+// idKey is the frontmatter key with the goodreads Book Id
+const idKey = "goodreads_id"
+
+// makeKeys returns the keys a note is found by, most specific first:
+// the goodreads id, ISBN13, ISBN then the normalized title and author.
+// baseName is only used if there's no title.
+func makeKeys(id, isbn13, isbn, title, author, baseName string) []string {
+	var keys []string
+	add := func(kind, val string) {
+		if val = strings.TrimSpace(val); val != "" {
+			keys = append(keys, kind+":"+val)
+		}
+	}
+	add("id", id)
+	add("isbn13", isbn13)
+	add("isbn", isbn)
+	if title = normalize.Text(title); title != "" {
+		add("title", title+"|"+normalize.Author(author))
+	} else {
+		add("file", baseName)
+	}
+	return keys
+}
+
+// identityKeys returns the keys of a note from its frontmatter.
+func identityKeys(fields *frontmatter.Frontmatter, baseName string) []string {
+	return makeKeys(fields.Get(idKey), fields.Get("isbn13"), fields.Get("isbn"),
+		fields.Get("title"), fields.Get("author"), baseName)
+}
+
+// bookKeys returns the keys the note for a cleaned up book would have.
+func bookKeys(book *Book) []string {
+	return makeKeys(book.Id, book.ISBN13, book.ISBN, book.Title, book.AuthorLF, "")
+}
+
+// addExisting indexes fname by its keys. A key that another note already
+// has is reported and left to the first note, unless they are editions
+// with different ids.
+func (c *Conf) addExisting(fname, id string, keys []string) {
+	c.existingIDs[fname] = id
+	for _, key := range keys {
+		if other, ok := c.existing[key]; ok && other != fname {
+			if otherID := c.existingIDs[other]; id == "" || otherID == "" || id == otherID {
+				fmt.Printf("Duplicate %s in %q and %q, using the first\n", key, other, fname)
+			}
+			continue
+		}
+		c.existing[key] = fname
+	}
+}
+
+// findExisting returns the note with the first of keys that matches.
+// A note with a different goodreads id is another edition, so it's only
+// matched by its id.
+func (c *Conf) findExisting(keys []string, id string) (string, bool) {
+	for _, key := range keys {
+		fname, ok := c.existing[key]
+		if !ok {
+			continue
+		}
+		if noteID := c.existingIDs[fname]; noteID != "" && id != "" && noteID != id {
+			continue
+		}
+		return fname, true
+	}
+	return "", false
+}
+
+// claim records that the note fname is updated from src. It returns false,
+// after reporting it, if another book already claimed it.
+func (c *Conf) claim(fname, src string) bool {
+	if other, ok := c.claimed[fname]; ok {
+		fmt.Printf("Both %q and %q match %q, skipping the second\n", other, src, fname)
+		return false
+	}
+	c.claimed[fname] = src
+	return true
+}
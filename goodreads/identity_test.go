@@ -0,0 +1,95 @@
+package goodreads
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestMakeKeys(t *testing.T) {
+	got := makeKeys("42", "9780151002177", "0151002177", `\#Girlboss: A Memoir`, "Amoruso, Sophia", "x.md")
+	want := []string{"id:42", "isbn13:9780151002177", "isbn:0151002177", "title:girlboss a memoir|amoruso sophia"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("makeKeys -> %q, want %q", got, want)
+	}
+	if got, want := makeKeys("", "", "", "", "", "x.md"), []string{"file:x.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("makeKeys without a title -> %q, want %q", got, want)
+	}
+	if got := makeKeys("", "", "", "#Girlboss: A Memoir", "Sophia Amoruso", ""); got[0] != want[3] {
+		t.Errorf("makeKeys should ignore the order of names, got %q", got)
+	}
+}
+
+func TestFindExisting(t *testing.T) {
+	c := NewConf("", "", "")
+	c.existing, c.existingIDs, c.claimed = map[string]string{}, map[string]string{}, map[string]string{}
+	c.addExisting("Old.md", "", makeKeys("", "", "111", "Old Book", "Writer, A", "Old.md"))
+	c.addExisting("Edition.md", "7", makeKeys("7", "", "", "Twice", "Writer, A", "Edition.md"))
+	// Same title and author, reported and left to the first note
+	c.addExisting("Copy.md", "", makeKeys("", "", "", "Old Book", "A Writer", "Copy.md"))
+
+	tests := []struct {
+		name  string
+		keys  []string
+		id    string
+		want  string
+		found bool
+	}{
+		{"isbn", makeKeys("1", "", "111", "Renamed", "", ""), "1", "Old.md", true},
+		{"title and author", makeKeys("2", "", "", "old book", "A Writer", ""), "2", "Old.md", true},
+		{"by id", makeKeys("7", "", "", "Other", "", ""), "7", "Edition.md", true},
+		{"other edition", makeKeys("8", "", "", "Twice", "Writer, A", ""), "8", "", false},
+		{"new", makeKeys("9", "", "", "New", "", ""), "9", "", false},
+	}
+	for _, test := range tests {
+		got, found := c.findExisting(test.keys, test.id)
+		if got != test.want || found != test.found {
+			t.Errorf("%s -> %q, %v, want %q, %v", test.name, got, found, test.want, test.found)
+		}
+	}
+
+	if !c.claim("Old.md", "a") || c.claim("Old.md", "b") {
+		t.Errorf("the second claim of a note should fail")
+	}
+}
+
+func TestLookupExisting(t *testing.T) {
+	vault := t.TempDir()
+	notes := map[string]string{
+		"books/Book.md":         "---\ntitle: Book\n---\n",
+		"books/Plain.md":        "Just text\n",
+		"read/2020/Moved.md":    "---\ngoodreads_id: 5\ntitle: Renamed\n---\n",
+		"ideas/Idea.md":         "---\ntitle: An idea\n---\n",
+		".trash/Deleted.md":     "---\ngoodreads_id: 6\n---\n",
+		"books/.goodreads/B.md": "---\ngoodreads_id: 7\n---\n",
+	}
+	for name, txt := range notes {
+		fname := filepath.Join(vault, name)
+		if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fname, []byte(txt), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := NewConf("", filepath.Join(vault, "books"), "")
+	c.VaultDir = vault
+	if err := c.LookupExisting(); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for fname := range c.existingIDs {
+		rel, _ := filepath.Rel(vault, fname)
+		got = append(got, rel)
+	}
+	sort.Strings(got)
+	want := []string{"books/Book.md", "books/Plain.md", "read/2020/Moved.md"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LookupExisting found %q, want %q", got, want)
+	}
+	if fname, _ := c.findExisting(makeKeys("5", "", "", "Moved", "", ""), "5"); fname != filepath.Join(vault, "read/2020/Moved.md") {
+		t.Errorf("findExisting by id -> %q, want the moved note", fname)
+	}
+}
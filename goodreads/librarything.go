@@ -0,0 +1,57 @@
+package goodreads
+
+import "strings"
+
+// libraryThingImporter reads LibraryThing's export, either the CSV or the
+// tab separated one.
+type libraryThingImporter struct{}
+
+// libraryThingShelves are the collections that are shelves on Goodreads
+var libraryThingShelves = map[string]string{
+	"to read":           "to-read",
+	"currently reading": "currently-reading",
+	"read but unowned":  "read",
+}
+
+func (libraryThingImporter) Required() []string {
+	return []string{"Title"}
+}
+
+func (libraryThingImporter) Book(row Row) (*Book, error) {
+	book := &Book{
+		Title:             row.Get("Title"),
+		AuthorLF:          row.Get("Primary Author", "Author (last, first)"),
+		AdditionalAuthors: row.Get("Secondary Author", "Other Authors"),
+		Rating:            strings.TrimSuffix(row.Get("Rating"), ".0"),
+		Pages:             row.Get("Page Count", "Pages"),
+		Year:              row.Get("Date", "Publication Date"),
+		DateRead:          row.Get("Date Read"),
+		DateAdded:         row.Get("Entry Date", "Date Entered"),
+		Review:            row.Get("Review"),
+		PrivateNotes:      row.Get("Private Comment", "Private Comments"),
+		Binding:           row.Get("Media"),
+		BCID:              row.Get("BCID"),
+	}
+	book.Author = firstLast(book.AuthorLF)
+	// "Crown Business (2014), Edition: 1, 224 pages"
+	publication := row.Get("Publication")
+	if idx := strings.Index(publication, " ("); idx >= 0 {
+		publication = publication[:idx]
+	}
+	book.Publisher = strings.TrimSpace(publication)
+	book.ISBN, book.ISBN13 = splitISBNs(row.Get("ISBNs") + "," + row.Get("ISBN"))
+	shelves := splitList(row.Get("Tags"))
+	for _, collection := range splitList(row.Get("Collections")) {
+		if shelf, ok := libraryThingShelves[strings.ToLower(collection)]; ok {
+			book.ExclusiveShelf = shelf
+		}
+	}
+	if book.ExclusiveShelf == "" && book.DateRead != "" {
+		book.ExclusiveShelf = "read"
+	}
+	if book.ExclusiveShelf != "" && book.ExclusiveShelf != "read" {
+		shelves = append([]string{book.ExclusiveShelf}, shelves...)
+	}
+	book.Bookshelves = strings.Join(shelves, ", ")
+	return book, nil
+}
@@ -0,0 +1,32 @@
+package goodreads
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLibraryThingImporter(t *testing.T) {
+	export := "Book Id\tTitle\tPrimary Author\tSecondary Author\tPublication\tDate\tReview\tRating\tPrivate Comment\tPage Count\tDate Read\tTags\tCollections\tISBN\tISBNs\tEntry Date\n" +
+		"123\tZero to One\tThiel, Peter\tMasters, Blake\tCrown Business (2014), Edition: 1, 224 pages\t2014\tGood\t4.5\tLent to Sam\t224\t2020-01-05\tbusiness\tYour library\t[0804139296]\t0804139296, 9780804139298\t2019-12-01\n" +
+		"124\tDune\tHerbert, Frank\t\t\t1965\t\t\t\t\t\t\tTo read, Wishlist\t\t\t2021-03-04\n"
+	books, rowErrs, err := parseCSV(strings.NewReader(export), libraryThingImporter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 2 || len(rowErrs) != 0 {
+		t.Fatalf("got %d books and %v, want 2 books", len(books), rowErrs)
+	}
+	got := *books[0]
+	want := Book{
+		Title: "Zero to One", Author: "Peter Thiel", AuthorLF: "Thiel, Peter", AdditionalAuthors: "Masters, Blake",
+		ISBN: "0804139296", ISBN13: "9780804139298", Publisher: "Crown Business", Year: "2014", Pages: "224",
+		Rating: "4.5", DateRead: "2020-01-05", DateAdded: "2019-12-01", Bookshelves: "business", ExclusiveShelf: "read",
+		Review: "Good", PrivateNotes: "Lent to Sam",
+	}
+	if got != want {
+		t.Errorf("first book -> %+v, want %+v", got, want)
+	}
+	if got := books[1]; got.Id != "" || got.ExclusiveShelf != "to-read" || got.Bookshelves != "to-read" {
+		t.Errorf("second book -> %+v", got)
+	}
+}
@@ -0,0 +1,298 @@
+package goodreads
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Conflict markers around the lines both the vault and goodreads changed
+const (
+	oursMarker   = "<<<<<<< vault"
+	sepMarker    = "======="
+	theirsMarker = ">>>>>>> goodreads"
+)
+
+// hunk is a change from a base: base[baseStart:baseEnd] was replaced by
+// side[start:end].
+type hunk struct {
+	baseStart, baseEnd int
+	start, end         int
+	ours               bool
+}
+
+// hunks returns the changes that turn base into side.
+func hunks(base, side []string, ours bool) []hunk {
+	var ret []hunk
+	b, s := 0, 0
+	var cur *hunk
+	for _, e := range diffLines(base, side) {
+		if e.op == ' ' {
+			if cur != nil {
+				ret = append(ret, *cur)
+				cur = nil
+			}
+			b++
+			s++
+			continue
+		}
+		if cur == nil {
+			cur = &hunk{baseStart: b, baseEnd: b, start: s, end: s, ours: ours}
+		}
+		if e.op == '-' {
+			b++
+			cur.baseEnd = b
+		} else {
+			s++
+			cur.end = s
+		}
+	}
+	if cur != nil {
+		ret = append(ret, *cur)
+	}
+	return ret
+}
+
+// merge3 applies the changes from base to ours and from base to theirs.
+// Where both changed the same lines differently both versions are kept
+// between conflict markers. Changes to adjacent lines, like two fields of
+// the frontmatter, both apply.
+// It returns the merged lines and the number of conflicts.
+func merge3(base, ours, theirs []string) ([]string, int) {
+	oursHunks, theirsHunks := hunks(base, ours, true), hunks(base, theirs, false)
+	all := make([]hunk, 0, len(oursHunks)+len(theirsHunks))
+	// Interleave them by baseStart, ours first on a tie
+	for i, j := 0, 0; i < len(oursHunks) || j < len(theirsHunks); {
+		if j == len(theirsHunks) || (i < len(oursHunks) && oursHunks[i].baseStart <= theirsHunks[j].baseStart) {
+			all = append(all, oursHunks[i])
+			i++
+		} else {
+			all = append(all, theirsHunks[j])
+			j++
+		}
+	}
+	var merged []string
+	conflicts := 0
+	// offsets are how many more lines ours and theirs have than base so far
+	oursOffset, theirsOffset := 0, 0
+	pos := 0
+	for i := 0; i < len(all); {
+		start, end := all[i].baseStart, all[i].baseEnd
+		hasOurs, hasTheirs := false, false
+		oursDelta, theirsDelta := 0, 0
+		j := i
+		for ; j < len(all) && (j == i || overlaps(all[j], start, end)); j++ {
+			h := all[j]
+			if h.baseEnd > end {
+				end = h.baseEnd
+			}
+			delta := (h.end - h.start) - (h.baseEnd - h.baseStart)
+			if h.ours {
+				hasOurs = true
+				oursDelta += delta
+			} else {
+				hasTheirs = true
+				theirsDelta += delta
+			}
+		}
+		merged = append(merged, base[pos:start]...)
+		oursLines := ours[start+oursOffset : end+oursOffset+oursDelta]
+		theirsLines := theirs[start+theirsOffset : end+theirsOffset+theirsDelta]
+		switch {
+		case !hasTheirs:
+			merged = append(merged, oursLines...)
+		case !hasOurs || equalLines(oursLines, theirsLines):
+			merged = append(merged, theirsLines...)
+		default:
+			conflicts++
+			merged = append(merged, oursMarker)
+			merged = append(merged, oursLines...)
+			merged = append(merged, sepMarker)
+			merged = append(merged, theirsLines...)
+			merged = append(merged, theirsMarker)
+		}
+		oursOffset += oursDelta
+		theirsOffset += theirsDelta
+		pos = end
+		i = j
+	}
+	merged = append(merged, base[pos:]...)
+	return merged, conflicts
+}
+
+// overlaps is true if h changes some of base[start:end], or if they are
+// both insertions at the same place, so the order isn't known.
+func overlaps(h hunk, start, end int) bool {
+	if h.baseStart < end {
+		return true
+	}
+	return h.baseStart == end && start == end && h.baseStart == h.baseEnd
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// stateFile is where the version of the note generated last time is kept
+func (c *Conf) stateFile(genFile string) string {
+	return filepath.Join(c.StateDir, filepath.Base(genFile))
+}
+
+// saveState keeps data as the last generated version of genFile.
+func (c *Conf) saveState(genFile string, data []byte) error {
+	if err := os.MkdirAll(c.StateDir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(c.stateFile(genFile), data, 0644)
+}
+
+// SaveState keeps the generated notes that are now in the vault as the
+// base of the next merge. Notes left identical keep the vault's copy since
+// it wasn't rewritten.
+// It must be called before the temp files are moved or deleted.
+func (c *Conf) SaveState(m moveFiles) error {
+	for _, mf := range m {
+		if mf.different {
+			continue
+		}
+		src := mf.fromFile
+		if mf.toFile == "" {
+			if mf.existing == "" {
+				// Skipped, nothing in the vault came from it
+				continue
+			}
+			src = mf.existing
+		}
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		if err := c.saveState(mf.fromFile, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeNote merges the changes made in the vault's copy of the note since
+// the last import with the newly generated one.
+// ok is false if there's no earlier import to use as the base.
+func (c *Conf) mergeNote(mf moveFile) (merged []string, conflicts int, ok bool, err error) {
+	baseBytes, err := os.ReadFile(c.stateFile(mf.fromFile))
+	if os.IsNotExist(err) {
+		return nil, 0, false, nil
+	} else if err != nil {
+		return nil, 0, false, err
+	}
+	oursBytes, err := os.ReadFile(mf.toFile)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	theirsBytes, err := os.ReadFile(mf.fromFile)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	merged, conflicts = merge3(splitLines(string(baseBytes)), splitLines(string(oursBytes)), splitLines(string(theirsBytes)))
+	return merged, conflicts, true, nil
+}
+
+// MergeDifferent three-way merges the notes that differ from the vault,
+// using the version generated last time as the base.
+// Conflicts are written with conflict markers and listed at the end.
+// Notes without an earlier import are left alone to compare by hand, and
+// the new version is kept as the base, so the next import merges them.
+// It returns how many notes are still different, in conflict or unmerged.
+func (c *Conf) MergeDifferent(m moveFiles) (int, error) {
+	var conflicted, noBase []moveFile
+	for _, mf := range m {
+		if !mf.different {
+			continue
+		}
+		merged, conflicts, ok, err := c.mergeNote(mf)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			noBase = append(noBase, mf)
+			if c.DryRun {
+				continue
+			}
+			// The vault's copy is left as it is, this version is the base
+			// of the next merge
+			theirs, err := os.ReadFile(mf.fromFile)
+			if err != nil {
+				return 0, err
+			}
+			if err := c.saveState(mf.fromFile, theirs); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if conflicts > 0 {
+			conflicted = append(conflicted, mf)
+		}
+		ours, err := os.ReadFile(mf.toFile)
+		if err != nil {
+			return 0, err
+		}
+		// Keep the final newline as it is, the kindle import doesn't write one
+		data := []byte(strings.Join(merged, "\n"))
+		if len(ours) == 0 || bytes.HasSuffix(ours, []byte("\n")) {
+			data = append(data, '\n')
+		}
+		changed := !bytes.Equal(data, ours)
+		if c.DryRun {
+			if changed && conflicts == 0 {
+				fmt.Printf("Would merge %q\n", mf.toFile)
+			}
+			continue
+		}
+		if changed {
+			if conflicts == 0 {
+				fmt.Printf("Merging %q\n", mf.toFile)
+			}
+			if err := os.WriteFile(mf.toFile, data, 0644); err != nil {
+				return 0, err
+			}
+		}
+		theirs, err := os.ReadFile(mf.fromFile)
+		if err != nil {
+			return 0, err
+		}
+		if err := c.saveState(mf.fromFile, theirs); err != nil {
+			return 0, err
+		}
+	}
+	if len(conflicted) > 0 {
+		if c.DryRun {
+			fmt.Printf("Would have conflicts in %d notes:\n", len(conflicted))
+		} else {
+			fmt.Printf("Conflicts in %d notes, look for %q:\n", len(conflicted), oursMarker)
+		}
+		for _, mf := range conflicted {
+			fmt.Printf("  %s\n", mf.toFile)
+		}
+	}
+	if len(noBase) > 0 {
+		fmt.Printf("No earlier import to merge %d notes with, compare them by hand, the next import merges them:\n", len(noBase))
+		for _, mf := range noBase {
+			if c.DryRun {
+				// The temp files are removed after a dry run
+				fmt.Printf("  %s\n", mf.toFile)
+			} else {
+				fmt.Printf("meld %q %q\n", mf.fromFile, mf.toFile)
+			}
+		}
+	}
+	return len(conflicted) + len(noBase), nil
+}
@@ -0,0 +1,118 @@
+package goodreads
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	tests := []struct {
+		name, base, ours, theirs, want string
+		conflicts                      int
+	}{
+		{"unchanged", "a\nb", "a\nb", "a\nb", "a\nb", 0},
+		{"only ours", "a\nb\nc", "a\nB\nc", "a\nb\nc", "a\nB\nc", 0},
+		{"only theirs", "a\nb\nc", "a\nb\nc", "a\nb\nC", "a\nb\nC", 0},
+		{
+			"both apart",
+			"rating: 3\nx\ny\nz\n## Review",
+			"rating: 3\nx\ny\nz\n## Review\nMy notes",
+			"rating: 4\nx\ny\nz\n## Review",
+			"rating: 4\nx\ny\nz\n## Review\nMy notes", 0,
+		},
+		{"same change", "a\nb\nc", "a\nB\nc", "a\nB\nc", "a\nB\nc", 0},
+		{
+			"conflict",
+			"a\nb\nc", "a\nmine\nc", "a\ntheirs\nc",
+			"a\n" + oursMarker + "\nmine\n" + sepMarker + "\ntheirs\n" + theirsMarker + "\nc", 1,
+		},
+		{"insert both ends", "a\nb", "start\na\nb", "a\nb\nend", "start\na\nb\nend", 0},
+		{"adjacent", "date: 1\ntags: a\n---", "date: 1\ntags: a, b\n---", "date: 2\ntags: a\n---", "date: 2\ntags: a, b\n---", 0},
+		{
+			"insert same place",
+			"a\nb", "a\nmine\nb", "a\ntheirs\nb",
+			"a\n" + oursMarker + "\nmine\n" + sepMarker + "\ntheirs\n" + theirsMarker + "\nb", 1,
+		},
+	}
+	for _, test := range tests {
+		got, conflicts := merge3(splitLines(test.base), splitLines(test.ours), splitLines(test.theirs))
+		if strings.Join(got, "\n") != test.want || conflicts != test.conflicts {
+			t.Errorf("%s -> %q, %d, want %q, %d\n", test.name, strings.Join(got, "\n"), conflicts, test.want, test.conflicts)
+		}
+	}
+}
+
+func TestMergeDifferent(t *testing.T) {
+	tmpDir, outDir := t.TempDir(), t.TempDir()
+	c := NewConf("", outDir, "")
+	write := func(fname, txt string) string {
+		if err := os.WriteFile(fname, []byte(txt), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return fname
+	}
+	gen := write(filepath.Join(tmpDir, "Book.md"), "date_read: 2023-01-02\n## Review\n")
+	vault := write(filepath.Join(outDir, "Book.md"), "date_read: 2023-01-01\n## Review\nLoved it\n")
+	m := moveFiles{{fromFile: gen, toFile: vault, different: true}}
+
+	// Without a base it's left alone
+	if unresolved, err := c.MergeDifferent(m); err != nil || unresolved != 1 {
+		t.Fatalf("MergeDifferent without a base -> %d, %v, want 1", unresolved, err)
+	}
+	if got, want := readString(t, vault), "date_read: 2023-01-01\n## Review\nLoved it\n"; got != want {
+		t.Errorf("merged without a base -> %q, want %q", got, want)
+	}
+	// but the new version is the base of the next import
+	if got, want := readString(t, c.stateFile(gen)), readString(t, gen); got != want {
+		t.Errorf("state without a base -> %q, want %q", got, want)
+	}
+	other := write(filepath.Join(tmpDir, "Other.md"), "title: B\nrating: 4\n## Review\n")
+	otherVault := write(filepath.Join(outDir, "Other.md"), "title: B\nrating: 4\n## Review\nLoved it\n")
+	otherMove := moveFiles{{fromFile: other, toFile: otherVault, different: true}}
+	if _, err := c.MergeDifferent(otherMove); err != nil {
+		t.Fatal(err)
+	}
+	write(other, "title: B\nrating: 5\n## Review\n")
+	if unresolved, err := c.MergeDifferent(otherMove); err != nil || unresolved != 0 {
+		t.Fatalf("MergeDifferent with the saved base -> %d, %v, want 0", unresolved, err)
+	}
+	if got, want := readString(t, otherVault), "title: B\nrating: 5\n## Review\nLoved it\n"; got != want {
+		t.Errorf("merged with the saved base -> %q, want %q", got, want)
+	}
+
+	if err := c.saveState(gen, []byte("date_read: 2023-01-01\n## Review\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.MergeDifferent(m); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readString(t, vault), "date_read: 2023-01-02\n## Review\nLoved it\n"; got != want {
+		t.Errorf("merged -> %q, want %q", got, want)
+	}
+	if got, want := readString(t, c.stateFile(gen)), readString(t, gen); got != want {
+		t.Errorf("state -> %q, want %q", got, want)
+	}
+
+	// A note the kindle import wrote without a final newline keeps it that way
+	write(vault, "date_read: 2023-01-02\n## Review\nLoved it")
+	if _, err := c.MergeDifferent(m); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readString(t, vault), "date_read: 2023-01-02\n## Review\nLoved it"; got != want {
+		t.Errorf("merged without a final newline -> %q, want %q", got, want)
+	}
+	if same, err := mdFilesEquivalent(write(gen, "date_read: 2023-01-02\n## Review\nLoved it\n"), vault); err != nil || !same {
+		t.Errorf("mdFilesEquivalent without a final newline -> %v, %v, want true", same, err)
+	}
+}
+
+func readString(t *testing.T, fname string) string {
+	t.Helper()
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
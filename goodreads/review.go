@@ -0,0 +1,158 @@
+package goodreads
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/scottkirkwood/obsidian/htmlutil"
+	"golang.org/x/net/html"
+)
+
+// spoilerCallout starts the collapsed callout spoilers are hidden in
+const spoilerCallout = "> [!warning]- Spoiler"
+
+var (
+	// Goodreads also takes [spoiler]...[/spoiler] in reviews
+	bbSpoilerRx  = regexp.MustCompile(`(?i)\[(/?)spoiler\]`)
+	blankLinesRx = regexp.MustCompile(`\n{3,}`)
+	lineEndRx    = regexp.MustCompile(`[ \t]+\n`)
+	// blockStartRx is text at the start of a line that Markdown takes as a
+	// quote, list or numbered list
+	blockStartRx = regexp.MustCompile(`^(\s*)(>|[-+] |\d+\. )`)
+	// inlineEscaper escapes the characters Markdown or Obsidian would take
+	// as formatting, links, tags or table cells
+	inlineEscaper = strings.NewReplacer(
+		`\`, `\\`, "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "|", `\|`,
+		"`", "\\`", "~", `\~`, "#", `\#`, "<", `\<`,
+	)
+)
+
+// reviewMarkdown converts a review from the export, which is HTML, to
+// Markdown. A review marked as a spoiler is all in the spoiler callout.
+func reviewMarkdown(review string, spoiler bool) string {
+	md := htmlToMarkdown(review)
+	if md == "" || !spoiler {
+		return md
+	}
+	return quoteBlock(spoilerCallout, md)
+}
+
+// htmlToMarkdown converts the formatting Goodreads allows in reviews and
+// notes: line breaks, paragraphs, italic, bold, links, lists, block quotes
+// and spoilers, which go in a collapsed callout.
+func htmlToMarkdown(txt string) string {
+	txt = bbSpoilerRx.ReplaceAllString(txt, "<${1}spoiler>")
+	// blocks are the quotes and spoilers being converted, innermost last
+	blocks := []*strings.Builder{{}}
+	// headers are the callout headers of blocks, "" for a quote
+	var headers []string
+	var links []string
+	closeBlock := func() {
+		inner := tidyMarkdown(blocks[len(blocks)-1].String())
+		header := headers[len(headers)-1]
+		headers, blocks = headers[:len(headers)-1], blocks[:len(blocks)-1]
+		blocks[len(blocks)-1].WriteString("\n\n" + quoteBlock(header, inner) + "\n\n")
+	}
+	z := html.NewTokenizer(strings.NewReader(txt))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		out := blocks[len(blocks)-1]
+		tok := z.Token()
+		switch tt {
+		case html.TextToken:
+			atLineStart := out.Len() == 0 || strings.HasSuffix(out.String(), "\n")
+			out.WriteString(escapeMarkdown(tok.Data, atLineStart))
+		case html.StartTagToken, html.SelfClosingTagToken:
+			switch tok.Data {
+			case "br":
+				out.WriteString("\n")
+			case "p", "div", "ul", "ol":
+				out.WriteString("\n\n")
+			case "li":
+				out.WriteString("\n- ")
+			case "i", "em":
+				out.WriteString("*")
+			case "b", "strong":
+				out.WriteString("**")
+			case "s", "strike", "del":
+				out.WriteString("~~")
+			case "a":
+				links = append(links, htmlutil.Attr(tok, "href"))
+				out.WriteString("[")
+			case "blockquote", "spoiler":
+				if tt == html.SelfClosingTagToken {
+					continue
+				}
+				header := ""
+				if tok.Data == "spoiler" {
+					header = spoilerCallout
+				}
+				headers = append(headers, header)
+				blocks = append(blocks, &strings.Builder{})
+			}
+		case html.EndTagToken:
+			switch tok.Data {
+			case "p", "div", "ul", "ol":
+				out.WriteString("\n\n")
+			case "i", "em":
+				out.WriteString("*")
+			case "b", "strong":
+				out.WriteString("**")
+			case "s", "strike", "del":
+				out.WriteString("~~")
+			case "a":
+				if len(links) == 0 {
+					continue
+				}
+				out.WriteString("](" + links[len(links)-1] + ")")
+				links = links[:len(links)-1]
+			case "blockquote", "spoiler":
+				if len(blocks) > 1 {
+					closeBlock()
+				}
+			}
+		}
+	}
+	// Close what was left open
+	for len(blocks) > 1 {
+		closeBlock()
+	}
+	return tidyMarkdown(blocks[0].String())
+}
+
+// escapeMarkdown escapes the text of a review so it shows as written.
+// atLineStart is true if txt starts a line, where it could start a block.
+func escapeMarkdown(txt string, atLineStart bool) string {
+	lines := strings.Split(inlineEscaper.Replace(txt), "\n")
+	for i, line := range lines {
+		if i > 0 || atLineStart {
+			lines[i] = blockStartRx.ReplaceAllStringFunc(line, func(start string) string {
+				idx := strings.IndexAny(start, ">-+.")
+				return start[:idx] + `\` + start[idx:]
+			})
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// quoteBlock returns md with each line quoted, after header if there is one.
+func quoteBlock(header, md string) string {
+	var lines []string
+	if header != "" {
+		lines = append(lines, header)
+	}
+	for _, line := range strings.Split(md, "\n") {
+		lines = append(lines, strings.TrimRight("> "+line, " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// tidyMarkdown removes spaces at the end of lines and extra blank lines.
+func tidyMarkdown(md string) string {
+	md = lineEndRx.ReplaceAllString(md, "\n")
+	md = blankLinesRx.ReplaceAllString(md, "\n\n")
+	return strings.TrimSpace(md)
+}
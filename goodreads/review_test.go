@@ -0,0 +1,43 @@
+package goodreads
+
+import "testing"
+
+func TestHtmlToMarkdown(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"I liked it.<br/>The end was weak. ", "I liked it.\nThe end was weak."},
+		{"A <i>great</i> <b>read</b> &amp; more", "A *great* **read** & more"},
+		{`See <a href="https://example.com">this</a>`, "See [this](https://example.com)"},
+		{"<p>One</p><p>Two</p>", "One\n\nTwo"},
+		{"Intro<ul><li>a</li><li>b</li></ul>", "Intro\n\n- a\n- b"},
+		{"He said<blockquote>no</blockquote>", "He said\n\n> no"},
+		{"Good.<spoiler>He dies.<br/>Really.</spoiler>Fun.",
+			"Good.\n\n> [!warning]- Spoiler\n> He dies.\n> Really.\n\nFun."},
+		{"Good. [spoiler]She lives[/spoiler]", "Good.\n\n> [!warning]- Spoiler\n> She lives"},
+		{"<spoiler>Unclosed", "> [!warning]- Spoiler\n> Unclosed"},
+		{"2*3 = 6, snake_case &amp; [[not a link]]", `2\*3 = 6, snake\_case & \[\[not a link\]\]`},
+		{"# not a header<br/>> not a quote<br/>- not a list<br/>1. not numbered", `\# not a header` + "\n" + `\> not a quote` + "\n" + `\- not a list` + "\n" + `1\. not numbered`},
+		{"a | b #tag `code` ~~no~~", "a \\| b \\#tag \\`code\\` \\~\\~no\\~\\~"},
+		{"Text - not a list <b>1. bold</b>", "Text - not a list **1. bold**"},
+	}
+	for _, test := range tests {
+		got := htmlToMarkdown(test.in)
+		if got != test.want {
+			t.Errorf("%q -> %q, want %q\n", test.in, got, test.want)
+		}
+	}
+}
+
+func TestReviewMarkdown(t *testing.T) {
+	got := reviewMarkdown("Twist:<br/><br/>the butler", true)
+	want := "> [!warning]- Spoiler\n> Twist:\n>\n> the butler"
+	if got != want {
+		t.Errorf("spoiler review -> %q, want %q\n", got, want)
+	}
+	if got := reviewMarkdown("", true); got != "" {
+		t.Errorf("empty review -> %q, want %q\n", got, "")
+	}
+}
@@ -0,0 +1,39 @@
+package goodreads
+
+import "strings"
+
+// storyGraphImporter reads the export from The StoryGraph's Manage Account
+// page.
+type storyGraphImporter struct{}
+
+func (storyGraphImporter) Required() []string {
+	return []string{"Title", "Authors"}
+}
+
+func (storyGraphImporter) Book(row Row) (*Book, error) {
+	book := &Book{
+		Title:          row.Get("Title"),
+		Binding:        row.Get("Format"),
+		DateRead:       row.Get("Last Date Read"),
+		DateAdded:      row.Get("Date Added"),
+		ExclusiveShelf: row.Get("Read Status"),
+		Review:         row.Get("Review"),
+		ReadCount:      row.Get("Read Count"),
+		Rating:         strings.TrimSuffix(row.Get("Star Rating"), ".0"),
+	}
+	if authors := splitList(row.Get("Authors")); len(authors) > 0 {
+		book.Author = authors[0]
+		book.AdditionalAuthors = strings.Join(authors[1:], ", ")
+	}
+	book.ISBN, book.ISBN13 = splitISBNs(row.Get("ISBN/UID", "ISBN"))
+	if strings.EqualFold(row.Get("Owned?"), "yes") {
+		book.OwnedCopies = "1"
+	}
+	// Like Goodreads, the shelves have the status unless it's read
+	shelves := splitList(row.Get("Tags"))
+	if book.ExclusiveShelf != "" && book.ExclusiveShelf != "read" {
+		shelves = append([]string{book.ExclusiveShelf}, shelves...)
+	}
+	book.Bookshelves = strings.Join(shelves, ", ")
+	return book, nil
+}
@@ -0,0 +1,31 @@
+package goodreads
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStoryGraphImporter(t *testing.T) {
+	export := "Title,Authors,Contributors,ISBN/UID,Format,Read Status,Date Added,Last Date Read,Dates Read,Read Count,Star Rating,Review,Tags,Owned?\n" +
+		"Zero to One,\"Peter Thiel, Blake Masters\",,9780804139298,hardcover,read,2022/01/02,2022/02/03,2022/01/10-2022/02/03,1,4.0,<b>Good</b>,\"business, startups\",Yes\n" +
+		"Dune,Frank Herbert,,B00B7NPRY8,digital,to-read,2023/05/06,,,0,,,,No\n"
+	books, rowErrs, err := parseCSV(strings.NewReader(export), storyGraphImporter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 2 || len(rowErrs) != 0 {
+		t.Fatalf("got %d books and %v, want 2 books", len(books), rowErrs)
+	}
+	got := *books[0]
+	want := Book{
+		Title: "Zero to One", Author: "Peter Thiel", AuthorLF: "Thiel, Peter", AdditionalAuthors: "Blake Masters",
+		ISBN13: "9780804139298", Binding: "hardcover", Rating: "4", DateRead: "2022/02/03", DateAdded: "2022/01/02",
+		Bookshelves: "business, startups", ExclusiveShelf: "read", Review: "<b>Good</b>", ReadCount: "1", OwnedCopies: "1",
+	}
+	if got != want {
+		t.Errorf("first book -> %+v, want %+v", got, want)
+	}
+	if got := books[1]; got.ISBN != "" || got.ISBN13 != "" || got.Bookshelves != "to-read" {
+		t.Errorf("second book -> %+v", got)
+	}
+}
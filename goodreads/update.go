@@ -0,0 +1,148 @@
+package goodreads
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/scottkirkwood/obsidian/frontmatter"
+)
+
+// fieldChange is a frontmatter key UpdateNotes changed
+type fieldChange struct {
+	key, from, to string
+}
+
+func (fc fieldChange) String() string {
+	show := func(val string) string {
+		if val == "" {
+			return "(none)"
+		}
+		return val
+	}
+	return fmt.Sprintf("%s: %s -> %s", fc.key, show(fc.from), show(fc.to))
+}
+
+// ownedFields returns the frontmatter keys that the importer owns in
+// update mode and their values for book, empty if it has none.
+func (c *Conf) ownedFields(book *Book) []struct{ key, val string } {
+	return []struct{ key, val string }{
+		{idKey, book.Id},
+		{"isbn", book.ISBN},
+		{"isbn13", book.ISBN13},
+		{"date_read", book.DateRead},
+		{"average", book.Average},
+		{"rating", book.Rating},
+		{"tags", strings.Join(c.makeTags(book), ", ")},
+	}
+}
+
+// UpdateNotes sets the keys the importer owns in the frontmatter of the
+// notes that already exist, leaving the other keys and the body alone.
+// The changes are printed for each note.
+// Afterwards c.books only has the books without a note.
+// LookupExisting must be called first.
+func (c *Conf) UpdateNotes() error {
+	var newBooks []*Book
+	updated := 0
+	for _, book := range c.books {
+		// cleanupBook changes the book in place, writeBook still needs it
+		cleaned := *book
+		c.cleanupBook(&cleaned)
+		fname, ok := c.findExisting(bookKeys(&cleaned), cleaned.Id)
+		// Editions share a title, the note with the book's name is its own
+		named := filepath.Join(c.outputDir, filepath.Base(c.tempFilename(book)))
+		if id, known := c.existingIDs[named]; known && (id == "" || id == cleaned.Id) {
+			fname, ok = named, true
+		}
+		if !ok {
+			newBooks = append(newBooks, book)
+			continue
+		}
+		if !c.claim(fname, cleaned.Title) {
+			continue
+		}
+		changes, err := c.updateNote(fname, &cleaned)
+		if err != nil {
+			fmt.Printf("Unable to update %q: %v\n", fname, err)
+			continue
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		updated++
+		fmt.Printf("%s:\n", filepath.Base(fname))
+		for _, change := range changes {
+			fmt.Printf("  %s\n", change)
+		}
+	}
+	if c.DryRun {
+		fmt.Printf("Would update %d notes\n", updated)
+	} else {
+		fmt.Printf("Updated %d notes\n", updated)
+	}
+	c.books = newBooks
+	return nil
+}
+
+// updateNote sets the owned keys of fname's frontmatter from book and
+// returns what changed.
+func (c *Conf) updateNote(fname string, book *Book) ([]fieldChange, error) {
+	fm, body, err := frontmatter.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	changes := c.setOwned(fm, c.ownedFields(book))
+	if len(changes) == 0 || c.DryRun {
+		return changes, nil
+	}
+	return changes, frontmatter.WriteFile(fname, fm, body)
+}
+
+// setOwned sets the owned keys of fm and returns what changed.
+func (c *Conf) setOwned(fm *frontmatter.Frontmatter, owned []struct{ key, val string }) []fieldChange {
+	var changes []fieldChange
+	for _, kv := range owned {
+		old := fm.Get(kv.key)
+		switch {
+		case kv.val == "":
+			// Other services don't have all the keys, so only Goodreads removes them
+			if !fm.Has(kv.key) || (c.Source != "" && c.Source != "goodreads") {
+				continue
+			}
+			fm.Delete(kv.key)
+		case kv.key == "tags":
+			vals := strings.Split(kv.val, ", ")
+			if equalLines(fm.List(kv.key), vals) {
+				continue
+			}
+			// Keep the way it was written
+			if fm.IsList(kv.key) {
+				fm.SetList(kv.key, vals)
+			} else {
+				fm.Set(kv.key, kv.val)
+			}
+		default:
+			if fm.Has(kv.key) && old == kv.val {
+				continue
+			}
+			fm.Set(kv.key, kv.val)
+		}
+		changes = append(changes, fieldChange{kv.key, old, kv.val})
+	}
+	return changes
+}
+
+// noteOwnedFields are the owned keys of a generated note, as ownedFields
+// has them.
+func (c *Conf) noteOwnedFields(fields *frontmatter.Frontmatter) []struct{ key, val string } {
+	owned := c.ownedFields(&Book{})
+	for i, kv := range owned {
+		if kv.key == "tags" {
+			owned[i].val = strings.Join(fields.List(kv.key), ", ")
+		} else {
+			owned[i].val = fields.Get(kv.key)
+		}
+	}
+	return owned
+}
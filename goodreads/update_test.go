@@ -0,0 +1,88 @@
+package goodreads
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/scottkirkwood/obsidian/frontmatter"
+)
+
+func TestUpdateNote(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "Book.md")
+	note := "---\ntitle: Book\nisbn: 123\ndate_read: 2020-01-01\nmine: kept\naverage: 3.5\ntags: [book, old]\nrating: 2\n---\n\n# Book\nMy notes\n"
+	if err := os.WriteFile(fname, []byte(note), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := NewConf("", "", "")
+	book := &Book{Title: "Book", ISBN: "123", DateRead: "2021-02-03", Average: "3.5", Bookshelves: "fiction"}
+	changes, err := c.updateNote(fname, book)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []fieldChange{
+		{"date_read", "2020-01-01", "2021-02-03"},
+		{"rating", "2", ""},
+		{"tags", "book, old", "book, fiction"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes -> %v, want %v", changes, want)
+	}
+	wantNote := "---\ntitle: Book\nisbn: 123\ndate_read: 2021-02-03\nmine: kept\naverage: 3.5\ntags:\n  - book\n  - fiction\n---\n\n# Book\nMy notes\n"
+	if got := readString(t, fname); got != wantNote {
+		t.Errorf("note -> %q, want %q", got, wantNote)
+	}
+
+	// Nothing changes the second time
+	if changes, err := c.updateNote(fname, book); err != nil || len(changes) != 0 {
+		t.Errorf("second update -> %v, %v, want no changes", changes, err)
+	}
+
+	// Another service without ISBNs or averages leaves them
+	c.Source = "storygraph"
+	changes, err = c.updateNote(fname, &Book{Title: "Book", DateRead: "2021-02-03", Rating: "4", Bookshelves: "fiction"})
+	if want := []fieldChange{{"rating", "", "4"}}; err != nil || !reflect.DeepEqual(changes, want) {
+		t.Errorf("storygraph update -> %v, %v, want %v", changes, err, want)
+	}
+}
+
+func TestFieldChange(t *testing.T) {
+	if got, want := (fieldChange{"rating", "", "4"}).String(), "rating: (none) -> 4"; got != want {
+		t.Errorf("String() -> %q, want %q", got, want)
+	}
+}
+
+func TestUpdateNotesEditions(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"Empire (Foundation #2)", "Empire (Foundation, #2)"} {
+		note := "---\ntitle: \"" + name + "\"\nauthor: Asimov, Isaac\n---\n"
+		if err := os.WriteFile(filepath.Join(dir, name+".md"), []byte(note), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := NewConf("", dir, "")
+	c.books = []*Book{
+		{Id: "1", Title: "Empire (Foundation, #2)", AuthorLF: "Asimov, Isaac"},
+		{Id: "2", Title: "Empire (Foundation #2)", AuthorLF: "Asimov, Isaac"},
+	}
+	if err := c.LookupExisting(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UpdateNotes(); err != nil {
+		t.Fatal(err)
+	}
+	// Each note gets the id of the book with its name
+	for name, want := range map[string]string{"Empire (Foundation, #2)": "1", "Empire (Foundation #2)": "2"} {
+		fields, _, err := frontmatter.ReadFile(filepath.Join(dir, name+".md"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fields.Get(idKey); got != want {
+			t.Errorf("%s %s = %q, want %q", name, idKey, got, want)
+		}
+	}
+	if len(c.books) != 0 {
+		t.Errorf("UpdateNotes left %d new books, want 0", len(c.books))
+	}
+}
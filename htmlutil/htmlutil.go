@@ -0,0 +1,15 @@
+// Package htmlutil has the helpers shared by the importers that read HTML
+// with golang.org/x/net/html.
+package htmlutil
+
+import "golang.org/x/net/html"
+
+// Attr returns the value of the attribute key of tok, or ""
+func Attr(tok html.Token, key string) string {
+	for _, a := range tok.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,26 @@
+package htmlutil
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestAttr(t *testing.T) {
+	z := html.NewTokenizer(strings.NewReader(`<a class="link" href="https://example.com">`))
+	z.Next()
+	tok := z.Token()
+	tests := []struct {
+		key, want string
+	}{
+		{"href", "https://example.com"},
+		{"class", "link"},
+		{"id", ""},
+	}
+	for _, test := range tests {
+		if got := Attr(tok, test.key); got != test.want {
+			t.Errorf("Attr(%q) = %q, want %q", test.key, got, test.want)
+		}
+	}
+}
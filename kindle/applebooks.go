@@ -0,0 +1,77 @@
+package kindle
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// appleQuery gets the annotations that weren't deleted, lib is the
+// attached BKLibrary database with the titles.
+const appleQuery = `SELECT a.ZANNOTATIONUUID AS id, %s,
+  IFNULL(a.ZANNOTATIONSELECTEDTEXT, '') AS text, IFNULL(a.ZANNOTATIONNOTE, '') AS note,
+  IFNULL(a.ZANNOTATIONCREATIONDATE, 0) AS date,
+  IFNULL(a.ZPLLOCATIONRANGESTART, 0) AS start, IFNULL(a.ZPLLOCATIONRANGEEND, 0) AS end
+FROM ZAEANNOTATION a %s
+WHERE IFNULL(a.ZANNOTATIONDELETED, 0) = 0
+ORDER BY a.ZANNOTATIONASSETID, start`
+
+// appleEpoch is when Apple's Core Data dates count from
+var appleEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// appleLibrary returns the BKLibrary database next to the AEAnnotation
+// one, which has the titles of the books, or "" if it isn't there.
+func appleLibrary(db string) string {
+	// .../Documents/AEAnnotation/AEAnnotation_v10312011_1727_local.sqlite
+	// .../Documents/BKLibrary/BKLibrary-1-091020131601.sqlite
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(filepath.Dir(db)), "BKLibrary", "BKLibrary*.sqlite"))
+	if len(matches) == 0 {
+		return ""
+	}
+	return matches[len(matches)-1]
+}
+
+// readAppleBooks reads the annotations in Apple Books' AEAnnotation database.
+func readAppleBooks(db string) (Clippings, error) {
+	query := fmt.Sprintf(appleQuery, "a.ZANNOTATIONASSETID AS title, '' AS author", "")
+	var setup []string
+	if lib := appleLibrary(db); lib != "" {
+		setup = append(setup, "ATTACH "+sqlQuote(lib)+" AS lib")
+		query = fmt.Sprintf(appleQuery,
+			"IFNULL(l.ZTITLE, a.ZANNOTATIONASSETID) AS title, IFNULL(l.ZAUTHOR, '') AS author",
+			"LEFT JOIN lib.ZBKLIBRARYASSET l ON l.ZASSETID = a.ZANNOTATIONASSETID")
+	}
+	rows, err := querySQLite(db, query, setup...)
+	if err != nil {
+		return nil, err
+	}
+	var clips Clippings
+	for _, row := range rows {
+		seconds, _ := strconv.ParseFloat(row["date"], 64)
+		clip := Clipping{
+			uid:   row["id"],
+			title: clipTitle(row["title"], row["author"]),
+			text:  row["text"],
+			date:  appleEpoch.Add(time.Duration(seconds * float64(time.Second))),
+		}
+		clip.start, _ = strconv.Atoi(row["start"])
+		clip.end, _ = strconv.Atoi(row["end"])
+		switch {
+		case clip.text != "":
+			clip.kind = Highlight
+			if row["note"] != "" {
+				clip.notes = []string{row["note"]}
+			}
+		case row["note"] != "":
+			clip.kind = Note
+			clip.text = row["note"]
+			clip.end = clip.start
+		default:
+			clip.kind = Bookmark
+			clip.end = clip.start
+		}
+		clips = append(clips, clip)
+	}
+	return clips, nil
+}
@@ -0,0 +1,217 @@
+package kindle
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/scottkirkwood/obsidian/frontmatter"
+	"github.com/scottkirkwood/obsidian/region"
+)
+
+// Ways to name the notes of each highlight, see Conf.AtomicNames
+const (
+	NameWords = "words" // The first words of the highlight
+	NameID    = "id"    // The block ID
+)
+
+const (
+	// idKey is the frontmatter key of a highlight note with its block ID
+	idKey = "kindle_id"
+	// nameWords is how many words of a highlight its note is named by
+	nameWords = 8
+	// inlineSuffix is added to the highlights header for the inline
+	// highlights kept when a book switches to atomic notes
+	inlineSuffix = " (inline)"
+)
+
+// readAtomicNotes finds the highlight notes already in c.AtomicDir by
+// their block ID, so they're kept even if they were renamed.
+func (c *Conf) readAtomicNotes() error {
+	c.atomicNotes = map[string]string{}
+	files, err := filepath.Glob(filepath.Join(c.AtomicDir, "*.md"))
+	if err != nil {
+		return err
+	}
+	for _, fname := range files {
+		fields, _, err := frontmatter.ReadFile(fname)
+		if err != nil {
+			fmt.Printf("Unable to read %s, %v\n", fname, err)
+			continue
+		}
+		if id := fields.Get(idKey); id != "" {
+			c.atomicNotes[id] = fname
+		}
+	}
+	return nil
+}
+
+// writeAtomic writes a note in c.AtomicDir for each of clips that doesn't
+// have one yet, and an index embedding them all in the highlights
+// section of bookFile.
+// Highlight notes that exist are left alone, they may have been edited.
+func (c *Conf) writeAtomic(bookFile string, clips []Clipping) error {
+	if c.atomicNotes == nil {
+		if err := c.readAtomicNotes(); err != nil {
+			return err
+		}
+	}
+	book := strings.TrimSuffix(filepath.Base(bookFile), filepath.Ext(bookFile))
+	fnames := make([]string, len(clips))
+	var created []Clipping
+	for i, clip := range clips {
+		fname, ok := c.atomicNotes[clip.blockID()]
+		if !ok {
+			fname = c.atomicFilename(clip)
+			c.atomicNotes[clip.blockID()] = fname
+			created = append(created, clip)
+			if !c.DryRun {
+				if err := c.writeHighlightNote(fname, book, clip); err != nil {
+					return err
+				}
+			}
+		}
+		fnames[i] = fname
+	}
+	if c.DryRun {
+		if len(created) > 0 {
+			fmt.Printf("Would create %d highlight notes in %q for %q\n", len(created), c.AtomicDir, bookFile)
+		}
+		return nil
+	}
+	if len(created) > 0 {
+		fmt.Printf("Created %d highlight notes in %q for %q\n", len(created), c.AtomicDir, bookFile)
+	}
+	index := c.atomicIndex(clips, fnames)
+	lines, err := readLines(bookFile)
+	if err != nil {
+		return err
+	}
+	if old, ok := region.Get(lines, regionName); ok && strings.TrimSpace(strings.Join(old, "\n")) == strings.TrimSpace(index) {
+		return nil
+	}
+	kept, n := c.inlineHighlights(lines)
+	lines = updateLines(bookFile, lines, c.Header+"\n", index)
+	if n > 0 {
+		keptHeader := strings.TrimSpace(c.Header) + inlineSuffix
+		fmt.Printf("Moved %d inline highlights of %q under %q, delete them once the highlight notes have your edits\n", n, bookFile, keptHeader)
+		lines = append(lines, "", keptHeader)
+		lines = append(lines, kept...)
+	}
+	return rewriteLines(bookFile, lines)
+}
+
+// inlineHighlights returns the highlights section of lines, as it is, if
+// it still has highlights written inline, with their block IDs or from
+// before them, and how many, so they aren't lost when the book switches
+// to atomic notes.
+func (c *Conf) inlineHighlights(lines []string) ([]string, int) {
+	section, ok := region.Get(lines, regionName)
+	if !ok {
+		if start, end := findSection(lines, c.Header); start != -1 {
+			section = lines[start+1 : end]
+		}
+	}
+	n := 0
+	for _, line := range section {
+		if rxBlockID.MatchString(line) || rxLegacyBlock.MatchString(line) {
+			n++
+		}
+	}
+	if n == 0 {
+		return nil, 0
+	}
+	return append([]string(nil), section...), n
+}
+
+// atomicFilename is a new file in c.AtomicDir for the note of clip.
+// Names by words that are already taken get the location added.
+func (c *Conf) atomicFilename(clip Clipping) string {
+	name := clip.blockID()
+	if c.AtomicNames != NameID {
+		words := strings.Fields(strings.NewReplacer("#", "", "^", "", "[", "", "]", "").Replace(clip.text))
+		if len(words) > nameWords {
+			words = words[:nameWords]
+		}
+		name = strings.TrimRight(safeName(strings.Join(words, " ")), ".,;- ")
+		if name == "" {
+			kind := clip.kind.String()
+			name = fmt.Sprintf("%s%s %d", strings.ToUpper(kind[:1]), kind[1:], clip.start)
+		}
+	}
+	fname := filepath.Join(c.AtomicDir, name+".md")
+	for n := 0; c.isTaken(fname); n++ {
+		suffix := " " + strconv.Itoa(clip.start)
+		if n > 0 {
+			suffix += "-" + strconv.Itoa(n)
+		}
+		fname = filepath.Join(c.AtomicDir, name+suffix+".md")
+	}
+	return fname
+}
+
+// isTaken is true if fname exists or will be written for another clipping
+func (c *Conf) isTaken(fname string) bool {
+	for _, other := range c.atomicNotes {
+		if other == fname {
+			return true
+		}
+	}
+	_, err := os.Stat(fname)
+	return err == nil
+}
+
+// writeHighlightNote writes the note of clip, which links back to book.
+func (c *Conf) writeHighlightNote(fname, book string, clip Clipping) error {
+	txt, err := c.renderBlock(clip)
+	if err != nil {
+		return err
+	}
+	fm := frontmatter.New()
+	fm.Set("book", "[["+book+"]]")
+	fm.Set("kind", clip.kind.String())
+	if clip.page > 0 {
+		fm.Set("page", strconv.Itoa(clip.page))
+	}
+	location := strconv.Itoa(clip.start)
+	if clip.end != clip.start {
+		location += "-" + strconv.Itoa(clip.end)
+	}
+	fm.Set("location", location)
+	if !clip.date.IsZero() {
+		fm.Set("date", clip.date.Format("2006-01-02"))
+	}
+	if clip.chapter != "" {
+		fm.Set("chapter", clip.chapter)
+	}
+	if clip.color != "" {
+		fm.Set("color", clip.color)
+	}
+	if clip.asin != "" {
+		fm.Set(asinKey, clip.asin)
+	}
+	fm.Set(idKey, clip.blockID())
+	fm.Set("tags", "highlight")
+	if err := os.MkdirAll(c.AtomicDir, 0755); err != nil {
+		return err
+	}
+	return frontmatter.WriteFile(fname, fm, []byte("\n"+txt))
+}
+
+// atomicIndex embeds the notes fnames of clips, under a subheading for
+// each chapter if they have them.
+func (c *Conf) atomicIndex(clips []Clipping, fnames []string) string {
+	var lines []string
+	chapter := ""
+	for i, clip := range clips {
+		if clip.chapter != "" && clip.chapter != chapter {
+			lines = append(lines, c.chapterHeading(clip.chapter), "")
+		}
+		chapter = clip.chapter
+		name := strings.TrimSuffix(filepath.Base(fnames[i]), ".md")
+		lines = append(lines, "![["+name+"]]", "")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,133 @@
+package kindle
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scottkirkwood/obsidian/frontmatter"
+	"github.com/scottkirkwood/obsidian/region"
+)
+
+func TestWriteAtomic(t *testing.T) {
+	dir := t.TempDir()
+	book := filepath.Join(dir, "Book.md")
+	if err := os.WriteFile(book, []byte("# Book\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := NewConf("", dir)
+	c.AtomicDir = filepath.Join(dir, "highlights")
+	date := time.Date(2021, 12, 11, 0, 0, 0, 0, time.UTC)
+	clips := []Clipping{
+		{title: "Book (Author)", chapter: "One", page: 3, start: 10, end: 12, date: date, text: "The [[first]] words of a highlight that goes on and on"},
+		{title: "Book (Author)", chapter: "One", start: 20, end: 20, text: "The first words of a highlight that goes on and on"},
+		{title: "Book (Author)", kind: Bookmark, start: 30, end: 30},
+	}
+	if err := c.writeAtomic(book, clips); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{
+		"The first words of a highlight that goes",
+		"The first words of a highlight that goes 20",
+		"Bookmark 30",
+	}
+	for i, name := range names {
+		fields, body, err := frontmatter.ReadFile(filepath.Join(c.AtomicDir, name+".md"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fields.Get("book"); got != "[[Book]]" {
+			t.Errorf("%s book = %q, want [[Book]]", name, got)
+		}
+		if got, want := fields.Get(idKey), clips[i].blockID(); got != want {
+			t.Errorf("%s %s = %q, want %q", name, idKey, got, want)
+		}
+		if !strings.Contains(string(body), "^"+clips[i].blockID()) {
+			t.Errorf("%s has no block ID in %q", name, body)
+		}
+	}
+	fields, _, _ := frontmatter.ReadFile(filepath.Join(c.AtomicDir, names[0]+".md"))
+	for key, want := range map[string]string{"page": "3", "location": "10-12", "date": "2021-12-11", "chapter": "One"} {
+		if got := fields.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+
+	lines, err := readLines(book)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, _ := region.Get(lines, regionName)
+	want := []string{"### One", "", "![[" + names[0] + "]]", "", "![[" + names[1] + "]]", "", "![[" + names[2] + "]]", ""}
+	if strings.Join(index, "\n") != strings.Join(want, "\n") {
+		t.Errorf("index ->\n%s\nwant\n%s", strings.Join(index, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Renamed notes are found by their ID and kept, new ones added
+	renamed := filepath.Join(c.AtomicDir, "Renamed.md")
+	if err := os.Rename(filepath.Join(c.AtomicDir, names[2]+".md"), renamed); err != nil {
+		t.Fatal(err)
+	}
+	c = NewConf("", dir)
+	c.AtomicDir = filepath.Join(dir, "highlights")
+	c.AtomicNames = NameID
+	added := Clipping{title: "Book (Author)", start: 40, end: 41, text: "More"}
+	if err := c.writeAtomic(book, append(clips, added)); err != nil {
+		t.Fatal(err)
+	}
+	lines, _ = readLines(book)
+	index, _ = region.Get(lines, regionName)
+	got := strings.Join(index, "\n")
+	for _, embed := range []string{"![[Renamed]]", "![[" + added.blockID() + "]]"} {
+		if !strings.Contains(got, embed) {
+			t.Errorf("index has no %s in\n%s", embed, got)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(c.AtomicDir, names[2]+".md")); err == nil {
+		t.Errorf("renamed note was written again")
+	}
+}
+
+func TestWriteAtomicKeepsInline(t *testing.T) {
+	dir := t.TempDir()
+	book := filepath.Join(dir, "Book.md")
+	clip := Clipping{title: "Book (Author)", start: 10, end: 12, text: "Words"}
+	inline := "> Words, with my edit ^" + clip.blockID()
+	txt := "# Book\n\n## Highlights\n" + strings.Join(region.Wrap(regionName, []string{inline}), "\n") + "\n"
+	if err := os.WriteFile(book, []byte(txt), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := NewConf("", dir)
+	c.AtomicDir = filepath.Join(dir, "highlights")
+	for i := 0; i < 2; i++ {
+		if err := c.writeAtomic(book, []Clipping{clip}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lines, err := readLines(book)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(lines, "\n")
+	if index, _ := region.Get(lines, regionName); !strings.Contains(strings.Join(index, "\n"), "![[Words]]") {
+		t.Errorf("no index in\n%s", got)
+	}
+	if strings.Count(got, inline) != 1 || !strings.Contains(got, "## Highlights"+inlineSuffix+"\n"+inline) {
+		t.Errorf("inline highlights not kept once in\n%s", got)
+	}
+
+	// So are sections from before block IDs
+	legacy := "- Page: 0 Pos: 10-12 Date: 2021-12-11\n> Words\nMy comment"
+	if err := os.WriteFile(book, []byte("# Book\n\n## Highlights\n"+legacy+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.writeAtomic(book, []Clipping{clip}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(book)
+	if !strings.Contains(string(data), "## Highlights"+inlineSuffix+"\n"+legacy) {
+		t.Errorf("legacy highlights not kept in\n%s", data)
+	}
+}
@@ -0,0 +1,156 @@
+package kindle
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/scottkirkwood/obsidian/frontmatter"
+)
+
+// NewBook is what the template for new book notes is given
+type NewBook struct {
+	Title    string
+	Author   string // First Last
+	AuthorLF string // Last, First as Kindle writes it
+	YamlTags string
+}
+
+// reviewItem is a Kindle title that couldn't be given a single note.
+type reviewItem struct {
+	title    string
+	fnames   []string // Empty if nothing matched
+	numClips int
+}
+
+// createNote makes a note for clipTitle from c.TemplateFile.
+func (c *Conf) createNote(clipTitle string) (string, error) {
+	if err := c.parseTemplate(); err != nil {
+		return "", err
+	}
+	book := newBook(clipTitle, c.Tags)
+	fname := filepath.Join(c.outputDir, noteFilename(book.Title))
+	if _, err := os.Stat(fname); err == nil {
+		return "", fmt.Errorf("%q exists but doesn't match", fname)
+	}
+	c.existing = append(c.existing, newBookNote(fname, book.Title, "", book.AuthorLF))
+	if c.DryRun {
+		fmt.Printf("Would create %q\n", fname)
+		return fname, nil
+	}
+	f, err := os.Create(fname)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	fmt.Printf("Creating %q\n", fname)
+	if err := c.template.Execute(f, book); err != nil {
+		return "", err
+	}
+	return fname, nil
+}
+
+func (c *Conf) parseTemplate() error {
+	if c.template != nil {
+		return nil
+	}
+	var err error
+	if c.TemplateFile == "" {
+		c.template, err = template.New("book-template.md").Parse(defaultTemplate)
+	} else {
+		c.template, err = template.ParseFiles(c.TemplateFile)
+	}
+	return err
+}
+
+func newBook(clipTitle string, tags []string) *NewBook {
+	title, author := splitClipTitle(clipTitle)
+	// Kindle titles sometimes repeat the short title before the subtitle
+	if parts := strings.SplitN(title, ": ", 3); len(parts) > 1 && parts[0] == parts[1] {
+		title = strings.Join(parts[1:], ": ")
+	}
+	book := &NewBook{
+		Title:    title,
+		Author:   author,
+		AuthorLF: author,
+	}
+	if parts := strings.SplitN(author, ", ", 2); len(parts) == 2 {
+		book.Author = parts[1] + " " + parts[0]
+	}
+	fm := frontmatter.New()
+	fm.Set("short_title", strings.Split(title, ":")[0])
+	fm.Set("title", title)
+	if author != "" {
+		fm.Set("author", book.AuthorLF)
+	}
+	if len(tags) > 0 {
+		fm.Set("tags", strings.Join(tags, ", "))
+	}
+	book.YamlTags = fm.String()
+	return book
+}
+
+// noteFilename is the title up to its subtitle without the characters
+// that aren't allowed in file names.
+func noteFilename(title string) string {
+	idx := strings.Index(title, ": ")
+	if idx > 10 {
+		title = title[:idx]
+	}
+	return safeName(title) + ".md"
+}
+
+// safeName replaces the characters that aren't allowed in file names.
+func safeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', '*', '|', '"', '<', '>', '=', '—', ':', '?':
+			return '-'
+		}
+		return r
+	}, name)
+}
+
+// writeReview writes the titles that need a person to decide which note
+// they go to.
+func (c *Conf) writeReview(items []reviewItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].title < items[j].title
+	})
+	lines := []string{"# Kindle review", ""}
+	section := func(header string, ambiguous bool) {
+		first := true
+		for _, item := range items {
+			if (len(item.fnames) > 0) != ambiguous {
+				continue
+			}
+			if first {
+				lines = append(lines, header, "")
+				first = false
+			}
+			lines = append(lines, fmt.Sprintf("- %q (%d clippings)", item.title, item.numClips))
+			for _, fname := range item.fnames {
+				name := strings.TrimSuffix(filepath.Base(fname), filepath.Ext(fname))
+				lines = append(lines, fmt.Sprintf("  - [[%s]]", name))
+			}
+		}
+		if !first {
+			lines = append(lines, "")
+		}
+	}
+	section("## Ambiguous", true)
+	section("## Not found", false)
+	lines = append(lines, fmt.Sprintf("Add the right note to %q as `Kindle title%snote.md`", c.AliasFile, aliasSep), "")
+	if c.DryRun {
+		fmt.Printf("Would write %d titles to review to %q\n", len(items), c.ReviewFile)
+		return nil
+	}
+	fmt.Printf("Writing %d titles to review to %q\n", len(items), c.ReviewFile)
+	return os.WriteFile(c.ReviewFile, []byte(strings.Join(lines, "\n")), 0644)
+}
@@ -0,0 +1,80 @@
+package kindle
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewBook(t *testing.T) {
+	book := newBook("Scary Smart: Scary Smart: The Future of AI (Gawdat, Mo)", []string{"book", "kindle"})
+	if book.Title != "Scary Smart: The Future of AI" || book.Author != "Mo Gawdat" || book.AuthorLF != "Gawdat, Mo" {
+		t.Errorf("got %+v", book)
+	}
+	want := "short_title: Scary Smart\ntitle: \"Scary Smart: The Future of AI\"\nauthor: Gawdat, Mo\ntags: book, kindle"
+	if book.YamlTags != want {
+		t.Errorf("YamlTags %q, want %q", book.YamlTags, want)
+	}
+	if got := noteFilename(book.Title); got != "Scary Smart.md" {
+		t.Errorf("noteFilename -> %q, want %q", got, "Scary Smart.md")
+	}
+}
+
+func TestNoteFilename(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Electrify", "Electrify.md"},
+		{"The Almanack of Naval Ravikant: A Guide", "The Almanack of Naval Ravikant.md"},
+		{"Short: Sub", "Short- Sub.md"},
+		{"A/B", "A-B.md"},
+	}
+	for _, test := range tests {
+		if got := noteFilename(test.in); got != test.want {
+			t.Errorf("%q -> %q, want %q\n", test.in, got, test.want)
+		}
+	}
+}
+
+func TestCreateAndReview(t *testing.T) {
+	dir := t.TempDir()
+	c := NewConf("", dir)
+	c.Create = true
+	c.TemplateFile = "book-template.md"
+	c.ReviewFile = filepath.Join(dir, "review.md")
+	for _, name := range []string{"Twin A.md", "Twin B.md"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("---\ntitle: Twin\n---\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.LookupExisting(); err != nil {
+		t.Fatal(err)
+	}
+	c.clippings = Clippings{
+		{title: "Electrify (Griffith, Saul)", start: 1, end: 2, text: "one"},
+		{title: "Electrify (Griffith, Saul)", start: 3, end: 4, text: "two"},
+		{title: "Twin", start: 1, end: 2, text: "which?"},
+	}
+	if err := c.UpdateExisting(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "Electrify.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"title: Electrify\n", "By **Saul Griffith**", "> one ^", "> two ^"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("new note is missing %q:\n%s", want, data)
+		}
+	}
+	review, err := os.ReadFile(c.ReviewFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"## Ambiguous", `- "Twin" (1 clippings)`, "[[Twin A]]", "[[Twin B]]"} {
+		if !strings.Contains(string(review), want) {
+			t.Errorf("review is missing %q:\n%s", want, review)
+		}
+	}
+}
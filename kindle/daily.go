@@ -0,0 +1,42 @@
+package kindle
+
+import (
+	"github.com/scottkirkwood/obsidian/daily"
+)
+
+// dailyRegion is the region of the daily notes with the highlights
+const dailyRegion = "kindle"
+
+// updateDaily lists the highlights and notes made each day, linked to
+// their block in the book note or their note in c.AtomicDir, in the
+// daily notes. Clippings without a date, like the notebook's, are left out.
+func (c *Conf) updateDaily(fileToClippings map[string][]Clipping) error {
+	days := daily.Days{}
+	for fname, clips := range fileToClippings {
+		for _, clip := range clips {
+			if clip.date.IsZero() || clip.kind == Bookmark {
+				continue
+			}
+			days.Add(clip.date, c.dailyLine(fname, clip))
+		}
+	}
+	_, err := c.Daily.Update(dailyRegion, days, c.DryRun)
+	return err
+}
+
+// dailyLine is the line of the daily note for clip, which is in the book
+// note fname. It links to the book note when its rows can't be linked to.
+func (c *Conf) dailyLine(fname string, clip Clipping) string {
+	verb := "Highlighted"
+	if clip.kind == Note {
+		verb = "Noted on"
+	}
+	if note, ok := c.atomicNotes[clip.blockID()]; ok {
+		return "- " + verb + " " + daily.Link(fname, "") + ": " + daily.Link(note, "")
+	}
+	target := ""
+	if c.linkableBlocks() {
+		target = "^" + clip.blockID()
+	}
+	return "- " + verb + " " + daily.Link(fname, target) + ": " + daily.Shorten(clip.text)
+}
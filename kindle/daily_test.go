@@ -0,0 +1,35 @@
+package kindle
+
+import (
+	"testing"
+)
+
+func TestDailyLine(t *testing.T) {
+	c := &Conf{}
+	clip := Clipping{title: "Book (Author)", start: 1, end: 2, text: "Quoted\nmore"}
+	note := Clipping{title: "Book (Author)", kind: Note, start: 2, end: 2, text: "Mine"}
+	tests := []struct {
+		clip Clipping
+		want string
+	}{
+		{clip, "- Highlighted [[Book#^" + clip.blockID() + "|Book]]: Quoted"},
+		{note, "- Noted on [[Book#^" + note.blockID() + "|Book]]: Mine"},
+	}
+	for _, test := range tests {
+		if got := c.dailyLine("/v/books/Book.md", test.clip); got != test.want {
+			t.Errorf("dailyLine -> %q, want %q", got, test.want)
+		}
+	}
+
+	// Table rows can't be linked to, so it links to the note
+	table := &Conf{BlockTemplate: "table"}
+	if got, want := table.dailyLine("/v/books/Book.md", clip), "- Highlighted [[Book]]: Quoted"; got != want {
+		t.Errorf("dailyLine with a table -> %q, want %q", got, want)
+	}
+
+	// With -atomic it links to the highlight's note
+	c.atomicNotes = map[string]string{clip.blockID(): "/v/highlights/Quoted.md"}
+	if got, want := c.dailyLine("/v/books/Book.md", clip), "- Highlighted [[Book]]: [[Quoted]]"; got != want {
+		t.Errorf("dailyLine -> %q, want %q", got, want)
+	}
+}
@@ -1,29 +1,71 @@
-package main
+package kindle
 
 import (
 	"bufio"
-	"flag"
+	_ "embed"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"text/template"
 	"time"
+
+	"github.com/scottkirkwood/obsidian/config"
+	"github.com/scottkirkwood/obsidian/daily"
+	"github.com/scottkirkwood/obsidian/frontmatter"
+	"github.com/scottkirkwood/obsidian/region"
 )
 
-var (
-	dirFlag    = flag.String("dir", "~/zk/Zettelkasten/books", "Folder to place .md files")
-	inFileFlag = flag.String("in", "My Clippings.txt", "File containing highlights and notes")
+// defaultTemplate is used for new notes when there's no template file
+//
+//go:embed book-template.md
+var defaultTemplate string
+
+// Kind is the type of clipping the Kindle recorded
+type Kind int
+
+const (
+	Highlight Kind = iota
+	Note
+	Bookmark
 )
 
+func (k Kind) String() string {
+	switch k {
+	case Note:
+		return "note"
+	case Bookmark:
+		return "bookmark"
+	}
+	return "highlight"
+}
+
 type Clipping struct {
-	title     string
-	page      int
-	start     int
-	end       int
-	date      time.Time
-	highlight string
+	title string
+	kind  Kind
+	page  int
+	start int
+	end   int // Same as start for notes and bookmarks
+	date  time.Time
+	text  string
+
+	// notes are the texts of the notes made at the location of this highlight
+	notes []string
+
+	// uid is the reader's id for it, empty for the Kindle which uses the location
+	uid string
+
+	// chapter and color are only in some formats, like the Kindle notebook
+	chapter string
+	color   string
+
+	// asin is the Amazon id of the book, for links to the clipping
+	asin string
 }
 
 type Clippings []Clipping
@@ -32,88 +74,326 @@ type Clippings []Clipping
 type Conf struct {
 	inputFile string
 	outputDir string
+	// Format is the format of inputFile, one of Formats, empty to guess it
+	// from its name
+	Format string
 
 	clippings Clippings
 
-	// key is shorttitle, (author) is the filename
-	existing map[string][]string
-}
+	// DryRun shows what would change without writing any files
+	DryRun bool
+
+	// MarkDeleted tags blocks whose clipping is gone with deletedTag
+	MarkDeleted bool
+
+	// Threshold is the minimum score for a note to match a title
+	Threshold float64
+	// Resolve asks on stdin which note to use when there's no single match
+	Resolve bool
+	stdin   *bufio.Reader
+
+	// aliases are the manual matches read from AliasFile,
+	// key is the Kindle title, value is the filename relative to outputDir
+	AliasFile string
+	aliases   map[string]string
 
-var (
-	// Ex. "- Your Highlight on page 190 | Location 1870-1871 | Added on Friday, April 15, 2022 12:24:16 AM"
+	// ASINFile has the lines "Kindle title => ASIN" for the books whose
+	// note has no asin in its frontmatter, for links to the highlights
+	ASINFile  string
+	asins     map[string]string
+	noteASINs map[string]string // Key is the note's file name
 
-	rxLocation = regexp.MustCompile(`- Your Highlight on page (\d+) \| Location (\d+)\-(\d+) \| Added on (.*)`)
+	existing []*bookNote
+	// matched caches the files found for each Kindle title
+	matched map[string][]string
+
+	// Create makes a note from TemplateFile for unmatched titles,
+	// an empty TemplateFile uses defaultTemplate
+	Create       bool
+	TemplateFile string
+	template     *template.Template
+
+	// ReviewFile lists the titles that matched several or no notes
+	ReviewFile string
+
+	// AtomicDir, if set, gets a note for each clipping, named by
+	// AtomicNames, and the book notes an index of them
+	AtomicDir   string
+	AtomicNames string
+	atomicNotes map[string]string // Key is the block ID
+
+	// Daily, if set, gets the highlights made each day listed in the
+	// daily notes
+	Daily *daily.Conf
+
+	// Header starts the section the clippings go in
+	Header string
+	// BlockTemplate renders each clipping, one of BlockTemplates or a
+	// file, empty for DefaultBlocks
+	BlockTemplate string
+	blockTemplate *blockTemplate
+	// Tags are put in the frontmatter of created notes
+	Tags []string
+}
+
+const (
+	horzLine = "=========="
+	// regionName marks the part of a note with the clippings, see region
+	regionName = "kindle"
+	// DefaultInput is the clippings file in the current folder
+	DefaultInput = "My Clippings.txt"
+	deletedTag   = "#kindle/deleted"
 )
 
+// States while parsing the clippings file
 const (
-	horzLine    = "=========="
-	clipsHeader = "## Highlights\n"
+	wantTitle = iota
+	wantMeta
+	wantText
+	skipClipping
 )
 
-func (c *Conf) Read(fname string) error {
+// parse reads the clippings from r.
+// Each clipping is a title line, a metadata line (see locales) and the text,
+// ending with horzLine.
+// Clippings with a metadata line that can't be parsed are skipped and
+// returned as ParseErrors, the others are still kept.
+func (c *Conf) parse(r io.Reader) error {
 	c.clippings = nil
-	file, err := os.Open(fname)
-	if err != nil {
-		return err
+	scanner := bufio.NewScanner(r)
+	var (
+		lastClipping Clipping
+		text         []string
+		errs         ParseErrors
+		state        = wantTitle
+	)
+	add := func() {
+		if state == wantText {
+			lastClipping.text = strings.TrimSpace(strings.Join(text, "\n"))
+			c.clippings = append(c.clippings, lastClipping)
+		}
+		lastClipping, text, state = Clipping{}, nil, wantTitle
 	}
-	defer file.Close()
-	scanner := bufio.NewScanner(file)
-	var lastClipping Clipping
 	lineNo := 0
 	for scanner.Scan() {
 		lineNo++
 		// For some bizarre reason, Titles often start with BOM Unicode marker
 		// Let's remove that
 		line := strings.Trim(scanner.Text(), "\ufeff")
-		if line == horzLine {
-			c.clippings = append(c.clippings, lastClipping)
-			lastClipping.title = ""
-		} else if lastClipping.title == "" {
-			lastClipping.title = line
-		} else if rxLocation.MatchString(line) {
-			matches := rxLocation.FindStringSubmatch(line)
-			lastClipping.page = toInt(matches[1], lineNo)
-			lastClipping.start = toInt(matches[2], lineNo)
-			lastClipping.end = toInt(matches[3], lineNo)
-			lastClipping.date = toDate(matches[4], lineNo)
-		} else {
-			lastClipping.highlight = line
+		switch {
+		case line == horzLine:
+			add()
+		case state == wantTitle:
+			if line != "" {
+				lastClipping.title = line
+				state = wantMeta
+			}
+		case state == wantMeta:
+			if err := lastClipping.parseMeta(line); err != nil {
+				errs = append(errs, &ParseError{Line: lineNo, Text: line, Err: err})
+				state = skipClipping
+				continue
+			}
+			state = wantText
+		case state == wantText:
+			text = append(text, line)
 		}
 	}
+	add()
 
 	if err := scanner.Err(); err != nil {
 		return err
 	}
+	c.clippings = c.clippings.attachNotes()
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
 
-func toInt(txt string, lineNo int) int {
-	num, err := strconv.Atoi(txt)
-	if err != nil {
-		fmt.Printf("Problem parsing number %q at line %d\n", txt, lineNo)
+// attachNotes moves the text of each note onto the highlight of the same
+// title that covers its location, so it can be shown under the quote.
+// Notes without such a highlight are kept as is.
+func (clips Clippings) attachNotes() Clippings {
+	ret := make(Clippings, 0, len(clips))
+	highlights := map[string][]int{} // title to indexes in ret
+	for _, clip := range clips {
+		if clip.kind != Note {
+			if clip.kind == Highlight {
+				highlights[clip.title] = append(highlights[clip.title], len(ret))
+			}
+			ret = append(ret, clip)
+		}
 	}
-	return num
+	for _, clip := range clips {
+		if clip.kind != Note {
+			continue
+		}
+		best := -1
+		for _, i := range highlights[clip.title] {
+			h := ret[i]
+			if clip.start < h.start || clip.start > h.end {
+				continue
+			}
+			if best == -1 || h.end-clip.start < ret[best].end-clip.start {
+				best = i
+			}
+		}
+		if best == -1 {
+			ret = append(ret, clip)
+			continue
+		}
+		ret[best].notes = append(ret[best].notes, clip.text)
+	}
+	return ret
+}
+
+// Dedupe collapses the highlights that were re-edited on the Kindle,
+// which leaves both the old and the new one in the clippings file.
+// It returns how many highlights were removed.
+func (c *Conf) Dedupe() int {
+	before := len(c.clippings)
+	c.clippings = c.clippings.dedupe()
+	return before - len(c.clippings)
 }
 
-func toDate(txt string, lineNo int) time.Time {
-	t, err := time.Parse("Monday, January 2, 2006 3:04:05 PM", txt)
+// dedupe merges the highlights of the same title whose locations overlap,
+// keeping the newest text, or the longest if they were made at the same time.
+func (clips Clippings) dedupe() Clippings {
+	ret := make(Clippings, 0, len(clips))
+	highlights := map[string][]int{} // title to indexes in ret
+	for _, clip := range clips {
+		if clip.kind != Highlight {
+			ret = append(ret, clip)
+			continue
+		}
+		dup := -1
+		for _, i := range highlights[clip.title] {
+			if ret[i].isDuplicate(clip) {
+				dup = i
+				break
+			}
+		}
+		if dup == -1 {
+			highlights[clip.title] = append(highlights[clip.title], len(ret))
+			ret = append(ret, clip)
+			continue
+		}
+		kept := ret[dup]
+		if clip.date.After(kept.date) || (clip.date.Equal(kept.date) && len(clip.text) > len(kept.text)) {
+			clip.notes = mergeNotes(kept.notes, clip.notes)
+			ret[dup] = clip
+		} else {
+			ret[dup].notes = mergeNotes(kept.notes, clip.notes)
+		}
+	}
+	return ret
+}
+
+// isDuplicate returns true if other is an edit of c.
+// Highlights next to each other often share a location, so sharing just
+// one location only counts when one text contains the other.
+func (c Clipping) isDuplicate(other Clipping) bool {
+	if c.title != other.title || c.kind != other.kind {
+		return false
+	}
+	start, end := c.start, c.end
+	if other.start > start {
+		start = other.start
+	}
+	if other.end < end {
+		end = other.end
+	}
+	if start > end {
+		return false
+	}
+	if end > start {
+		return true
+	}
+	return strings.Contains(c.text, other.text) || strings.Contains(other.text, c.text)
+}
+
+func mergeNotes(a, b []string) []string {
+	ret := append([]string(nil), a...)
+	for _, note := range b {
+		found := false
+		for _, existing := range ret {
+			if existing == note {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ret = append(ret, note)
+		}
+	}
+	return ret
+}
+
+func toInt(txt string) (int, error) {
+	num, err := strconv.Atoi(txt)
 	if err != nil {
-		fmt.Printf("Problem parsing date %q at line %d\n", txt, lineNo)
+		return num, fmt.Errorf("problem parsing number %q", txt)
 	}
-	return t
+	return num, nil
 }
 
-func createConf(inFile, outputDir string) *Conf {
-	outputDir = strings.ReplaceAll(outputDir, "~", "$HOME")
-	outputDir = os.ExpandEnv(outputDir)
+func NewConf(inFile, outputDir string) *Conf {
+	outputDir = config.ExpandPath(outputDir)
 	return &Conf{
-		inputFile: inFile,
-		outputDir: outputDir,
+		inputFile:  inFile,
+		outputDir:  outputDir,
+		Threshold:  0.8,
+		AliasFile:  filepath.Join(outputDir, ".kindle-aliases"),
+		ASINFile:   filepath.Join(outputDir, ".kindle-asins"),
+		stdin:      bufio.NewReader(os.Stdin),
+		ReviewFile: "kindle-review.md",
+		Header:     "## Highlights",
+		Tags:       []string{"book", "kindle"},
+	}
+}
+
+// FromConfig returns the Conf for the [kindle] settings of conf.
+func FromConfig(conf *config.Config) *Conf {
+	k := conf.Kindle
+	inFile := DefaultInput
+	if k.Input != "" {
+		inFile = conf.Path(k.Input)
+	}
+	c := NewConf(inFile, conf.KindleDir())
+	c.TemplateFile = conf.Path(k.Template)
+	c.Threshold = k.Threshold
+	c.Format = k.Format
+	c.BlockTemplate = k.Blocks
+	if filepath.Ext(k.Blocks) != "" {
+		// A file rather than a built in name
+		c.BlockTemplate = conf.Path(k.Blocks)
+	}
+	c.Tags = k.Tags
+	if k.Header != "" {
+		c.Header = k.Header
+	}
+	if k.Aliases != "" {
+		c.AliasFile = conf.Path(k.Aliases)
+	}
+	if k.Review != "" {
+		c.ReviewFile = conf.Path(k.Review)
+	}
+	c.AtomicDir = conf.Path(k.Atomic)
+	c.AtomicNames = k.Names
+	if k.Daily {
+		c.Daily = daily.FromConfig(conf)
+	}
+	if k.ASINs != "" {
+		c.ASINFile = conf.Path(k.ASINs)
 	}
+	return c
 }
 
 func (c *Conf) LookupExisting() error {
-	c.existing = map[string][]string{}
+	c.existing = nil
+	c.matched = map[string][]string{}
+	c.noteASINs = map[string]string{}
 	glob := filepath.Join(c.outputDir, "*.md")
 	files, err := filepath.Glob(glob)
 	if err != nil {
@@ -123,95 +403,446 @@ func (c *Conf) LookupExisting() error {
 		fmt.Printf("Note: no files found for %q\n", glob)
 	}
 	for _, fname := range files {
-		fields, err := readMdFile(fname)
+		fields, _, err := frontmatter.ReadFile(fname)
 		if err != nil {
 			fmt.Printf("Unable to read %s, %v\n", fname, err)
 			continue
 		}
-		title, author := fields["title"], fields["author"]
-		c.addExisting(title, author, fname)
-		if strings.Contains(title, "–") {
-			split := strings.Split(title, "–")
-			if len(split[0]) > 10 {
-				c.addExisting(split[0], author, fname)
-			}
+		c.existing = append(c.existing, newBookNote(fname, fields.Get("title"), fields.Get("short_title"), fields.Get("author")))
+		if asin := cleanASIN(fields.Get(asinKey)); asin != "" {
+			c.noteASINs[fname] = asin
 		}
-		c.addExisting(fields["short_title"], author, fname)
 	}
-	return nil
-}
-
-func (c *Conf) addExisting(title, author, fname string) {
-	title = strings.TrimSpace(title)
-	author = strings.TrimSpace(author)
-	fname = strings.TrimSpace(fname)
-	key := fmt.Sprintf("%s (%s)", title, author)
-	if title == "" {
-		key = fmt.Sprintf("(%s)", author)
-	} else if author == "" {
-		key = title
+	if err := c.readASINs(); err != nil {
+		return err
 	}
-	c.existing[key] = append(c.existing[key], fname)
+	return c.readAliases()
 }
 
 func (c *Conf) findFiles(clip Clipping) ([]string, error) {
-	fnames, ok := c.existing[clip.title]
+	fnames, ok := c.matched[clip.title]
 	if !ok {
-		fmt.Printf("Not found %q\n", clip.title)
+		fnames = c.match(clip.title)
+		c.matched[clip.title] = fnames
 	}
 	return fnames, nil
 }
 
+// UpdateExisting adds the clippings to the notes they match.
+// Titles without a note get one if c.Create, the others, and those that
+// match several notes, are written to c.ReviewFile.
 func (c *Conf) UpdateExisting() error {
 	fileToClippings := map[string][]Clipping{}
+	review := map[string]*reviewItem{}
 	for _, clip := range c.clippings {
 		files, err := c.findFiles(clip)
 		if err != nil {
 			return err
 		}
-		if len(files) > 0 {
-			if len(files) == 1 {
-				fname := files[0]
-				fileToClippings[fname] = append(fileToClippings[fname], clip)
+		if len(files) == 0 && c.Create {
+			fname, err := c.createNote(clip.title)
+			if err != nil {
+				fmt.Printf("Unable to create note for %q: %v\n", clip.title, err)
+			} else {
+				files = []string{fname}
 			}
+			c.matched[clip.title] = files
+		}
+		if len(files) == 1 {
+			fname := files[0]
+			fileToClippings[fname] = append(fileToClippings[fname], clip)
+			continue
+		}
+		if review[clip.title] == nil {
+			review[clip.title] = &reviewItem{title: clip.title, fnames: files}
 		}
+		review[clip.title].numClips++
 	}
 	for fname, clips := range fileToClippings {
-		if err := c.updateFile(fname, clips); err != nil {
+		clips = c.withASIN(fname, clips)
+		update := c.updateFile
+		if c.AtomicDir != "" {
+			update = c.writeAtomic
+		}
+		if err := update(fname, clips); err != nil {
 			return err
 		}
+		fileToClippings[fname] = clips
 	}
-	return nil
+	if c.Daily != nil {
+		if err := c.updateDaily(fileToClippings); err != nil {
+			return err
+		}
+	}
+	items := make([]reviewItem, 0, len(review))
+	for _, item := range review {
+		items = append(items, *item)
+	}
+	return c.writeReview(items)
 }
 
+// updateFile adds the clippings to the highlights section of fname.
+// Blocks already in the section, found by their block ID, are left alone
+// so that any links, tags or comments added under them are kept. So is
+// everything in a section written before block IDs, whose blocks get
+// theirs added.
 func (c *Conf) updateFile(fname string, clips []Clipping) error {
-	lines := make([]string, 0, len(clips))
+	lines, err := readLines(fname)
+	if os.IsNotExist(err) && c.DryRun {
+		// It would have been made by createNote
+		fmt.Printf("Would add %d to %q\n", len(clips), fname)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	tagged := c.tagLegacyBlocks(lines, clips)
+	newLines, added, deleted, ok, err := c.mergeClippings(lines, clips)
+	if err != nil {
+		return err
+	}
+	if c.DryRun {
+		if !ok {
+			added = len(clips)
+		}
+		if tagged > 0 {
+			fmt.Printf("Would add block IDs to %d highlights in %q\n", tagged, fname)
+		}
+		if added > 0 || deleted > 0 {
+			fmt.Printf("Would add %d, mark %d deleted in %q\n", added, deleted, fname)
+		}
+		return nil
+	}
+	if !ok {
+		// No section yet, so write it all
+		txt, err := c.renderBlocks(clips)
+		if err != nil {
+			return err
+		}
+		return updateFileWithText(fname, c.Header+"\n", txt)
+	}
+	if tagged > 0 {
+		fmt.Printf("Adding block IDs to %d highlights in %q\n", tagged, fname)
+	}
+	if added == 0 && deleted == 0 && tagged == 0 {
+		return nil
+	}
+	fmt.Printf("Adding %d, marking %d deleted in %q\n", added, deleted, fname)
+	tmpFilename, err := writeLines(fname, newLines)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFilename, fname)
+}
+
+// mergeClippings appends the clippings whose block ID isn't in the
+// kindle region, or the highlights section if there's none, to the end of it.
+// If c.MarkDeleted, blocks no longer in clips are tagged with deletedTag.
+// It returns false if there's no section to merge into.
+func (c *Conf) mergeClippings(lines []string, clips []Clipping) (newLines []string, added, deleted int, ok bool, err error) {
+	start, end := region.Find(lines, regionName)
+	if start == -1 {
+		start, end = findSection(lines, c.Header)
+	}
+	if start == -1 {
+		return lines, 0, 0, false, nil
+	}
+	section := append([]string(nil), lines[start:end]...)
+	seen := map[string]bool{}
+	for _, line := range section {
+		if matches := rxBlockID.FindStringSubmatch(line); matches != nil {
+			seen[matches[1]] = true
+		}
+	}
+	current := map[string]bool{}
+	var newClips []Clipping
 	for _, clip := range clips {
-		lines = append(lines, clip.makeTextBlock())
+		id := clip.blockID()
+		current[id] = true
+		if !seen[id] {
+			newClips = append(newClips, clip)
+		}
+	}
+	if c.MarkDeleted {
+		for i, line := range section {
+			matches := rxBlockID.FindStringSubmatchIndex(line)
+			if matches == nil || current[line[matches[2]:matches[3]]] || strings.Contains(line, deletedTag) {
+				continue
+			}
+			// The ID can be on a line of its own
+			before := strings.TrimRight(line[:matches[2]-1], " \t")
+			if before != "" {
+				before += " "
+			}
+			section[i] = before + deletedTag + " " + line[matches[2]-1:]
+			deleted++
+		}
+	}
+	header, err := c.renderHeader()
+	if err != nil {
+		return nil, 0, 0, false, err
 	}
-	return updateFileWithText(fname, clipsHeader, strings.Join(lines, "\n"))
+	var blocks []string
+	for _, clip := range newClips {
+		if clip.chapter != "" {
+			if section, err = c.addToChapter(section, clip); err != nil {
+				return nil, 0, 0, false, err
+			}
+			continue
+		}
+		block, err := c.renderBlock(clip)
+		if err != nil {
+			return nil, 0, 0, false, err
+		}
+		blocks = append(blocks, block)
+	}
+	section = trimBlankLines(section)
+	newLines = append(newLines, lines[:start]...)
+	newLines = append(newLines, section...)
+	if len(blocks) > 0 && header != "" {
+		// More rows of the table
+		newLines = append(newLines, strings.TrimSuffix(strings.Join(blocks, ""), "\n"), "")
+	} else if len(blocks) > 0 {
+		newLines = append(newLines, "", strings.Join(blocks, "\n"))
+	} else if end < len(lines) {
+		newLines = append(newLines, "")
+	}
+	newLines = append(newLines, lines[end:]...)
+	return newLines, len(newClips), deleted, true, nil
 }
 
-func (c Clipping) makeTextBlock() string {
-	return fmt.Sprintf("- Page: %d Pos: %d-%d Date: %s\n> %s\n", c.page, c.start, c.end, c.date.Format("2006-01-02"), c.highlight)
+// rxLegacyBlock is the first line of a highlight written before block IDs
+var rxLegacyBlock = regexp.MustCompile(`^- Page: (\d+) Pos: (\d+)-(\d+)(?: Date: \S+)?\s*$`)
+
+// tagLegacyBlocks adds the block ID of the clipping at the same page and
+// location to each block of the highlights section of lines written
+// before block IDs, at the end of its quote, so mergeClippings keeps the
+// block and what was added under it. It returns how many were tagged.
+func (c *Conf) tagLegacyBlocks(lines []string, clips []Clipping) int {
+	start, end := region.Find(lines, regionName)
+	if start == -1 {
+		start, end = findSection(lines, c.Header)
+	}
+	if start == -1 {
+		return 0
+	}
+	section := lines[start:end]
+	used := map[int]bool{}
+	tagged := 0
+	for i, line := range section {
+		matches := rxLegacyBlock.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		last := i
+		for last+1 < len(section) && strings.HasPrefix(section[last+1], ">") {
+			last++
+		}
+		if rxBlockID.MatchString(section[last]) {
+			continue
+		}
+		page, _ := strconv.Atoi(matches[1])
+		start, _ := strconv.Atoi(matches[2])
+		end, _ := strconv.Atoi(matches[3])
+		for j, clip := range clips {
+			if used[j] || clip.page != page || clip.start != start || clip.end != end {
+				continue
+			}
+			used[j] = true
+			section[last] = strings.TrimRight(section[last], " \t") + " ^" + clip.blockID()
+			tagged++
+			break
+		}
+	}
+	return tagged
 }
 
+// renderBlocks returns the text blocks of clips, under a subheading for
+// each chapter if they have them.
+func (c *Conf) renderBlocks(clips []Clipping) (string, error) {
+	header, err := c.renderHeader()
+	if err != nil {
+		return "", err
+	}
+	var parts, group []string
+	chapter := ""
+	for i, clip := range clips {
+		if i > 0 && clip.chapter != "" && clip.chapter != chapter {
+			parts = append(parts, joinBlocks(header, group))
+			group = nil
+		}
+		if clip.chapter != "" && clip.chapter != chapter {
+			parts = append(parts, c.chapterHeading(clip.chapter)+"\n")
+		}
+		chapter = clip.chapter
+		block, err := c.renderBlock(clip)
+		if err != nil {
+			return "", err
+		}
+		group = append(group, block)
+	}
+	if len(group) > 0 {
+		parts = append(parts, joinBlocks(header, group))
+	}
+	return strings.Join(parts, "\n"), nil
+}
+
+// chapterHeading is the subheading, one level below c.Header, that the
+// clippings of chapter go under.
+func (c *Conf) chapterHeading(chapter string) string {
+	level := headingLevel(c.Header) + 1
+	if level == 1 {
+		level = 3
+	} else if level > 6 {
+		level = 6
+	}
+	return strings.Repeat("#", level) + " " + chapter
+}
+
+// addToChapter adds the block of clip to the end of its chapter in
+// section, or a new chapter at the end if it doesn't have one yet.
+func (c *Conf) addToChapter(section []string, clip Clipping) ([]string, error) {
+	header, err := c.renderHeader()
+	if err != nil {
+		return nil, err
+	}
+	txt, err := c.renderBlock(clip)
+	if err != nil {
+		return nil, err
+	}
+	heading := c.chapterHeading(clip.chapter)
+	block := strings.Split(strings.TrimSuffix(txt, "\n"), "\n")
+	start := -1
+	for i, line := range section {
+		if line == heading {
+			start = i
+			break
+		}
+	}
+	if start == -1 {
+		section = append(trimBlankLines(section), "", heading, "")
+		if header != "" {
+			section = append(section, strings.Split(strings.TrimSuffix(header, "\n"), "\n")...)
+		}
+		return append(section, block...), nil
+	}
+	end := start + 1
+	for end < len(section) && !rxHeading.MatchString(section[end]) {
+		end++
+	}
+	// Before the blank lines at the end of the chapter
+	at := end
+	for at > start+1 && strings.TrimSpace(section[at-1]) == "" {
+		at--
+	}
+	ret := append([]string(nil), section[:at]...)
+	if header == "" {
+		ret = append(ret, "")
+	}
+	ret = append(ret, block...)
+	if at < len(section) && strings.TrimSpace(section[at]) != "" {
+		ret = append(ret, "")
+	}
+	return append(ret, section[at:]...), nil
+}
+
+// trimBlankLines removes the blank lines at the end, keeping the first line.
+func trimBlankLines(lines []string) []string {
+	for len(lines) > 1 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// findSection returns the range of lines from header up to the next
+// heading, or -1 if header isn't found.
+func findSection(lines []string, header string) (start, end int) {
+	header = strings.TrimSpace(header)
+	level := headingLevel(header)
+	for i, line := range lines {
+		if line != header {
+			continue
+		}
+		for end = i + 1; end < len(lines); end++ {
+			if isSectionEnd(lines[end], level) {
+				break
+			}
+		}
+		return i, end
+	}
+	return -1, -1
+}
+
+var rxHeading = regexp.MustCompile(`^(#{1,6})( |$)`)
+
+// headingLevel returns the number of #s of a heading, 0 if it isn't one
+func headingLevel(line string) int {
+	matches := rxHeading.FindStringSubmatch(line)
+	if matches == nil {
+		return 0
+	}
+	return len(matches[1])
+}
+
+// isSectionEnd is true for a heading that ends a section under a heading
+// of level, so its subheadings are part of it.
+func isSectionEnd(line string, level int) bool {
+	if strings.HasPrefix(line, "---") {
+		return true
+	}
+	lineLevel := headingLevel(line)
+	return lineLevel > 0 && (level == 0 || lineLevel <= level)
+}
+
+// rxBlockID finds the Obsidian block ID written by blockID, at the end of
+// a line or in the last cell of a table row
+var rxBlockID = regexp.MustCompile(`(?:^|\s)\^(kindle-[0-9a-f]{8}-\d+-\d+)\s*(?:\|\s*)?$`)
+
+// blockID is a stable ID for the clipping made from its title, kind,
+// location and uid.
+func (c Clipping) blockID() string {
+	h := fnv.New32a()
+	io.WriteString(h, c.kind.String()+"|"+c.title)
+	if c.uid != "" {
+		// Other readers can have several at the same location
+		io.WriteString(h, "|"+c.uid)
+	}
+	return fmt.Sprintf("kindle-%08x-%d-%d", h.Sum32(), c.start, c.end)
+}
+
+// updateFileWithText replaces what's in the kindle region of fname with txt.
+// Without a region the section under header is replaced by the header and
+// a region with txt at the end of the file.
 func updateFileWithText(fname, header, txt string) error {
 	lines, err := readLines(fname)
 	if err != nil {
 		return err
 	}
-	hasHeader := strings.Contains(strings.Join(lines, "\n"), header)
-	if hasHeader {
-		// replace
+	return rewriteLines(fname, updateLines(fname, lines, header, txt))
+}
+
+// updateLines is updateFileWithText on the lines of fname.
+func updateLines(fname string, lines []string, header, txt string) []string {
+	if newLines, ok := region.Replace(lines, regionName, []string{txt}); ok {
 		fmt.Printf("Updating %q\n", fname)
-		lines = removeHeaderSection(lines, header)
+		lines = newLines
 	} else {
-		// append
-		fmt.Printf("Appending to %q\n", fname)
+		hasHeader := strings.Contains(strings.Join(lines, "\n"), header)
+		if hasHeader {
+			// replace
+			fmt.Printf("Updating %q\n", fname)
+			lines = removeHeaderSection(lines, header)
+		} else {
+			// append
+			fmt.Printf("Appending to %q\n", fname)
+		}
+		lines = append(lines, header)
+		lines = append(lines, region.Wrap(regionName, []string{txt})...)
 	}
-	lines = append(lines, header)
-	lines = append(lines, txt)
+	return lines
+}
+
+// rewriteLines replaces fname with lines.
+func rewriteLines(fname string, lines []string) error {
 	tmpFilename, err := writeLines(fname, lines)
 	if err != nil {
 		return err
@@ -223,10 +854,12 @@ func removeHeaderSection(lines []string, header string) []string {
 	newLines := make([]string, 0, len(lines))
 	inHeader := false
 	header = strings.TrimSpace(header)
+	level := headingLevel(header)
 	for _, line := range lines {
 		if inHeader {
-			if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "---") {
+			if isSectionEnd(line, level) {
 				inHeader = false
+				newLines = append(newLines, line)
 			}
 		} else {
 			if line == header {
@@ -264,46 +897,56 @@ func writeLines(fname string, lines []string) (string, error) {
 	return tmpFilename, err
 }
 
-var (
-	keyString = regexp.MustCompile(`([^:]+): "(.*)"`)
-	keyVal    = regexp.MustCompile(`([^:]+): (.*)`)
-)
-
-// Note: this also exists in goodreads2obs.go should be refactored
-func readMdFile(fname string) (map[string]string, error) {
-	fields := make(map[string]string)
-	bytes, err := os.ReadFile(fname)
-	if err != nil {
-		return fields, err
+// Import adds the clippings in the input file to the notes in outputDir.
+func (c *Conf) Import() error {
+	if err := c.Load(); err != nil {
+		return err
 	}
-	lines := strings.Split(string(bytes), "\n")
-	for _, line := range lines {
-		matches := keyString.FindStringSubmatch(line)
-		if len(matches) == 3 {
-			fields[matches[1]] = matches[2]
-			continue
-		}
-		matches = keyVal.FindStringSubmatch(line)
-		if len(matches) == 3 {
-			fields[matches[1]] = matches[2]
-		}
+	if err := c.LookupExisting(); err != nil {
+		return fmt.Errorf("unable to lookup existing: %v", err)
+	}
+	if err := c.UpdateExisting(); err != nil {
+		return fmt.Errorf("unable to update existing: %v", err)
 	}
-	return fields, nil
+	return nil
 }
 
-func main() {
-	conf := createConf(*inFileFlag, *dirFlag)
-	err := conf.Read(*inFileFlag)
-	if err != nil {
-		fmt.Printf("Unable to read %q: %v\n", *inFileFlag, err)
-		return
+// Load reads the clippings of the input file, reporting the ones that
+// can't be read, and collapses their duplicates.
+func (c *Conf) Load() error {
+	err := c.Read(c.inputFile)
+	var parseErrs ParseErrors
+	if errors.As(err, &parseErrs) {
+		for _, parseErr := range parseErrs {
+			fmt.Printf("Skipping clipping in %q %v\n", c.inputFile, parseErr)
+		}
+	} else if err != nil {
+		return fmt.Errorf("unable to read %q: %v", c.inputFile, err)
 	}
-	if err := conf.LookupExisting(); err != nil {
-		fmt.Printf("Unable to lookup existing: %v\n", err)
-		return
+	if collapsed := c.Dedupe(); collapsed > 0 {
+		fmt.Printf("Collapsed %d duplicate highlights\n", collapsed)
 	}
-	if err := conf.UpdateExisting(); err != nil {
-		fmt.Printf("Unable to update existing: %v\n", err)
-		return
+	return nil
+}
+
+// HighlightCounts returns how many highlights each book has, by a link to
+// its note when the title matches one, or else by the title as the reader
+// wrote it. Load and LookupExisting must be called first.
+func (c *Conf) HighlightCounts() (map[string]int, error) {
+	counts := map[string]int{}
+	for _, clip := range c.clippings {
+		if clip.kind != Highlight {
+			continue
+		}
+		files, err := c.findFiles(clip)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 1 {
+			counts[daily.Link(files[0], "")]++
+		} else {
+			counts[clip.title]++
+		}
 	}
+	return counts, nil
 }
@@ -0,0 +1,374 @@
+package kindle
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Titles often start with a BOM, which Read strips
+const testClippings = "\ufeff" + `The Anthropocene Reviewed (Green, John)
+- Your Highlight on page 166 | Location 2166-2167 | Added on Saturday, December 11, 2021 1:17:08 PM
+
+more land and more water are devoted to the cultivation of lawn grass
+==========
+The Anthropocene Reviewed (Green, John)
+- Your Note on page 166 | Location 2167 | Added on Saturday, December 11, 2021 1:17:58 PM
+
+More grass grown than corn or wheat combined
+==========
+The Anthropocene Reviewed (Green, John)
+- Your Note on page 170 | Location 2200 | Added on Saturday, December 11, 2021 1:20:00 PM
+
+A lonely note
+==========
+The Anthropocene Reviewed (Green, John)
+- Your Bookmark on page 171 | Location 2210 | Added on Saturday, December 11, 2021 1:21:00 PM
+
+
+==========
+`
+
+func TestParse(t *testing.T) {
+	c := &Conf{}
+	if err := c.parse(strings.NewReader(testClippings)); err != nil {
+		t.Fatal(err)
+	}
+	type summary struct {
+		kind       Kind
+		start, end int
+		text       string
+		notes      []string
+	}
+	want := []summary{
+		{Highlight, 2166, 2167, "more land and more water are devoted to the cultivation of lawn grass", []string{"More grass grown than corn or wheat combined"}},
+		{Bookmark, 2210, 2210, "", nil},
+		{Note, 2200, 2200, "A lonely note", nil},
+	}
+	got := []summary{}
+	for _, clip := range c.clippings {
+		if clip.title != "The Anthropocene Reviewed (Green, John)" {
+			t.Errorf("title %q", clip.title)
+		}
+		got = append(got, summary{clip.kind, clip.start, clip.end, clip.text, clip.notes})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parse -> %+v, want %+v", got, want)
+	}
+}
+
+func TestBlockID(t *testing.T) {
+	a := Clipping{title: "Book (Author)", start: 10, end: 12}
+	b := Clipping{title: "Book (Author)", start: 10, end: 12, text: "edited", date: time.Now()}
+	if a.blockID() != b.blockID() {
+		t.Errorf("%q != %q, want the same ID for the same title and location", a.blockID(), b.blockID())
+	}
+	for _, other := range []Clipping{
+		{title: "Other (Author)", start: 10, end: 12},
+		{title: "Book (Author)", start: 10, end: 13},
+		{title: "Book (Author)", kind: Note, start: 10, end: 12},
+	} {
+		if a.blockID() == other.blockID() {
+			t.Errorf("%+v has the same ID as %+v", other, a)
+		}
+	}
+	for _, name := range BlockTemplates {
+		c := &Conf{BlockTemplate: name}
+		for _, line := range strings.Split(mustRender(t, c, a), "\n") {
+			if rxBlockID.MatchString(line) {
+				return
+			}
+		}
+		t.Errorf("rxBlockID doesn't match %q with %s", mustRender(t, c, a), name)
+	}
+}
+
+func TestMergeClippings(t *testing.T) {
+	old := Clipping{title: "T", start: 1, end: 2, text: "old"}
+	gone := Clipping{title: "T", start: 3, end: 4, text: "gone"}
+	added := Clipping{title: "T", start: 5, end: 6, text: "new"}
+	lines := []string{
+		"# T",
+		"## Highlights",
+		"",
+		"- Page: 0 Pos: 1-2 Date: 0001-01-01",
+		"> old ^" + old.blockID(),
+		"",
+		"My comment with [[Link]]",
+		"",
+		"- Page: 0 Pos: 3-4 Date: 0001-01-01",
+		"> gone ^" + gone.blockID(),
+		"",
+		"## After",
+		"Kept",
+	}
+	c := &Conf{MarkDeleted: true}
+	got, nAdded, nDeleted, ok, err := c.mergeClippings(lines, []Clipping{old, added})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || nAdded != 1 || nDeleted != 1 {
+		t.Fatalf("mergeClippings -> added %d, deleted %d, ok %v, want 1, 1, true", nAdded, nDeleted, ok)
+	}
+	want := append(append([]string{}, lines[:9]...),
+		"> gone "+deletedTag+" ^"+gone.blockID(),
+		"",
+		mustRender(t, c, added),
+		"## After",
+		"Kept",
+	)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeClippings ->\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Running again changes nothing
+	if _, nAdded, nDeleted, _, _ := c.mergeClippings(got, []Clipping{old, added}); nAdded != 0 || nDeleted != 0 {
+		t.Errorf("second mergeClippings -> added %d, deleted %d, want 0, 0", nAdded, nDeleted)
+	}
+
+	// Sections without block IDs are kept and added to
+	c.Header = "## Highlights"
+	got, nAdded, _, ok, _ = c.mergeClippings([]string{"## Highlights", "- Page: 1", "> old"}, []Clipping{old})
+	if want := []string{"## Highlights", "- Page: 1", "> old", "", mustRender(t, c, old)}; !ok || nAdded != 1 || !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeClippings without block IDs ->\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if _, _, _, ok, _ := c.mergeClippings([]string{"# T"}, []Clipping{old}); ok {
+		t.Errorf("mergeClippings without a section -> ok, want false")
+	}
+
+	// Only the region is changed when there's one
+	lines = []string{
+		"## Highlights",
+		"%% begin kindle %%",
+		"> old ^" + old.blockID(),
+		"%% end kindle %%",
+		"My notes",
+	}
+	got, nAdded, _, ok, _ = c.mergeClippings(lines, []Clipping{old, added})
+	want = []string{lines[0], lines[1], lines[2], "", mustRender(t, c, added), lines[3], lines[4]}
+	if !ok || nAdded != 1 || !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeClippings in region ->\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestUpdateLegacyFile(t *testing.T) {
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "T.md")
+	date := time.Date(2021, 12, 11, 0, 0, 0, 0, time.UTC)
+	first := Clipping{title: "T", page: 3, start: 10, end: 12, date: date, text: "first"}
+	second := Clipping{title: "T", page: 4, start: 20, end: 21, date: date, text: "second"}
+	added := Clipping{title: "T", page: 9, start: 90, end: 91, date: date, text: "added"}
+	// As written by the tool before block IDs, with the user's edits
+	legacy := "# T\n## Highlights\n" +
+		"- Page: 3 Pos: 10-12 Date: 2021-12-11\n> first\nMy comment [[Link]] #tag\n\n" +
+		"- Page: 4 Pos: 20-21 Date: 2021-12-11\n> second\n\n" +
+		"- Page: 5 Pos: 50-51 Date: 2021-12-11\n> no longer in the clippings\n%% why I kept it %%\n"
+	if err := os.WriteFile(fname, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := NewConf("", dir)
+	if err := c.updateFile(fname, []Clipping{first, second, added}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	for _, want := range []string{
+		"- Page: 3 Pos: 10-12 Date: 2021-12-11\n> first ^" + first.blockID() + "\nMy comment [[Link]] #tag\n",
+		"- Page: 4 Pos: 20-21 Date: 2021-12-11\n> second ^" + second.blockID() + "\n",
+		"> no longer in the clippings\n%% why I kept it %%\n",
+		mustRender(t, c, added),
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("no %q in\n%s", want, got)
+		}
+	}
+	if n := strings.Count(got, "> first"); n != 1 {
+		t.Errorf("first is in the note %d times, want 1:\n%s", n, got)
+	}
+
+	// Running again changes nothing
+	if err := c.updateFile(fname, []Clipping{first, second, added}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(fname); string(data) != got {
+		t.Errorf("second updateFile ->\n%s\nwant\n%s", data, got)
+	}
+}
+
+func TestMergeChapters(t *testing.T) {
+	c := &Conf{Header: "## Highlights"}
+	one := Clipping{title: "T", chapter: "One", start: 1, end: 2, text: "first"}
+	two := Clipping{title: "T", chapter: "Two", start: 9, end: 9, text: "second"}
+	txt, err := c.renderBlocks([]Clipping{one, two})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split("## Highlights\n\n"+txt+"\n## After", "\n")
+	want := []string{
+		"## Highlights", "",
+		"### One", "",
+		"- Page: 0 Pos: 1-2", "> first ^" + one.blockID(), "",
+		"### Two", "",
+		"- Page: 0 Pos: 9-9", "> second ^" + two.blockID(), "",
+		"## After",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("renderBlocks ->\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+
+	// New clippings go at the end of their chapter, or in a new one
+	more := Clipping{title: "T", chapter: "One", start: 5, end: 6, text: "more"}
+	three := Clipping{title: "T", chapter: "Three", start: 20, end: 20, text: "third"}
+	got, added, _, ok, err := c.mergeClippings(lines, []Clipping{one, two, more, three})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"## Highlights", "",
+		"### One", "",
+		"- Page: 0 Pos: 1-2", "> first ^" + one.blockID(), "",
+		"- Page: 0 Pos: 5-6", "> more ^" + more.blockID(), "",
+		"### Two", "",
+		"- Page: 0 Pos: 9-9", "> second ^" + two.blockID(), "",
+		"### Three", "",
+		"- Page: 0 Pos: 20-20", "> third ^" + three.blockID(), "",
+		"## After",
+	}
+	if !ok || added != 2 || !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeClippings with chapters -> %d ->\n%s\nwant\n%s", added, strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestUpdateFileWithText(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "Book.md")
+	tests := []struct {
+		name, in, want string
+	}{
+		{"append", "# Book\n", "# Book\n## Highlights\n\n%% begin kindle %%\nnew\n%% end kindle %%"},
+		{"section", "## Highlights\nold\n## Mine\n", "## Mine\n## Highlights\n\n%% begin kindle %%\nnew\n%% end kindle %%"},
+		{"region", "## Highlights\n%% begin kindle %%\nold\n%% end kindle %%\nmine\n", "## Highlights\n%% begin kindle %%\nnew\n%% end kindle %%\nmine"},
+	}
+	for _, test := range tests {
+		if err := os.WriteFile(fname, []byte(test.in), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := updateFileWithText(fname, "## Highlights\n", "new"); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(fname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != test.want {
+			t.Errorf("%s -> %q, want %q\n", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseLocales(t *testing.T) {
+	tests := []struct {
+		meta  string
+		kind  Kind
+		page  int
+		start int
+		end   int
+		date  string
+	}{
+		{"- Your Highlight at location 1234-1240 | Added on Friday, April 15, 2022 12:24:16 AM", Highlight, 0, 1234, 1240, "2022-04-15 00:24:16"},
+		{"- Your Bookmark on Location 50 | Added on Friday, 15 April 2022 09:24:16", Bookmark, 0, 50, 50, "2022-04-15 09:24:16"},
+		{"- Votre surlignement sur la page 12 | emplacement 150-152 | Ajouté le samedi 11 décembre 2021 13:17:08", Highlight, 12, 150, 152, "2021-12-11 13:17:08"},
+		{"- Votre note à l'emplacement 152 | Ajouté le vendredi 1 avril 2022 8:00:00", Note, 0, 152, 152, "2022-04-01 08:00:00"},
+		{"- La tua evidenziazione a pagina 7 | posizione 90-95 | Aggiunto in data sabato 11 dicembre 2021 13:17:08", Highlight, 7, 90, 95, "2021-12-11 13:17:08"},
+		{"- Il tuo segnalibro alla posizione 90 | Aggiunto in data sabato 11 dicembre 2021 13:17:08", Bookmark, 0, 90, 90, "2021-12-11 13:17:08"},
+		{"- Tu subrayado en la página 3 | posición 40-41 | Añadido el sábado, 11 de diciembre de 2021 13:17:08", Highlight, 3, 40, 41, "2021-12-11 13:17:08"},
+		{"- Ihre Notiz auf Seite 5 | Position 60 | Hinzugefügt am Samstag, 11. Dezember 2021 13:17:08", Note, 5, 60, 60, "2021-12-11 13:17:08"},
+	}
+	for _, test := range tests {
+		var clip Clipping
+		if err := clip.parseMeta(test.meta); err != nil {
+			t.Errorf("%q got error %v", test.meta, err)
+			continue
+		}
+		got := []interface{}{clip.kind, clip.page, clip.start, clip.end, clip.date.Format("2006-01-02 15:04:05")}
+		want := []interface{}{test.kind, test.page, test.start, test.end, test.date}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q -> %v, want %v", test.meta, got, want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	in := "Book (Author)\n- Your Highlight on page 1 | Location 1-2 | Added on yesterday\n\nText\n==========\n" +
+		"Book (Author)\n- Your Highlight on page 2 | Location 3-4 | Added on Friday, April 15, 2022 12:24:16 AM\n\nKept\n==========\n"
+	c := &Conf{}
+	err := c.parse(strings.NewReader(in))
+	errs, ok := err.(ParseErrors)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("got error %v, want one ParseError", err)
+	}
+	if errs[0].Line != 2 {
+		t.Errorf("error at line %d, want 2", errs[0].Line)
+	}
+	if len(c.clippings) != 1 || c.clippings[0].text != "Kept" {
+		t.Errorf("clippings %+v, want only the one with text \"Kept\"", c.clippings)
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2022, 4, d, 0, 0, 0, 0, time.UTC)
+	}
+	c := &Conf{clippings: Clippings{
+		{title: "A", start: 1870, end: 1871, date: day(1), text: "short", notes: []string{"n1"}},
+		{title: "A", start: 1870, end: 1875, date: day(2), text: "short and longer"},
+		{title: "A", start: 1875, end: 1880, date: day(3), text: "next sentence"},
+		{title: "B", start: 1870, end: 1871, date: day(1), text: "other book"},
+		{title: "A", start: 1880, end: 1880, date: day(3), text: "sentence"},
+		{title: "A", kind: Note, start: 1872, end: 1872, date: day(3), text: "a note"},
+	}}
+	if got := c.Dedupe(); got != 2 {
+		t.Errorf("Dedupe() -> %d, want 2", got)
+	}
+	want := []string{"short and longer", "next sentence", "other book", "a note"}
+	got := []string{}
+	for _, clip := range c.clippings {
+		got = append(got, clip.text)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Dedupe() left %q, want %q", got, want)
+	}
+	if !reflect.DeepEqual(c.clippings[0].notes, []string{"n1"}) {
+		t.Errorf("notes %q, want the ones of the replaced highlight", c.clippings[0].notes)
+	}
+}
+
+func TestHighlightCounts(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "The Book.md"), []byte("---\ntitle: The Book\nauthor: Ann Author\n---\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := NewConf("", dir)
+	c.clippings = []Clipping{
+		{title: "The Book (Ann Author)", kind: Highlight, start: 1},
+		{title: "The Book (Ann Author)", kind: Highlight, start: 2},
+		{title: "The Book (Ann Author)", kind: Note, start: 2},
+		{title: "Unknown (Nobody)", kind: Highlight, start: 3},
+	}
+	if err := c.LookupExisting(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.HighlightCounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"[[The Book]]": 2, "Unknown (Nobody)": 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("HighlightCounts() = %v, want %v", got, want)
+	}
+}
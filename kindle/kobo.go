@@ -0,0 +1,57 @@
+package kindle
+
+import (
+	"strconv"
+	"time"
+)
+
+// koboQuery gets the highlights, notes and dog-ears that weren't deleted,
+// with the book they're in and their chapter's position and title.
+const koboQuery = `SELECT b.BookmarkID AS id, v.Title AS title, IFNULL(v.Attribution, '') AS author,
+  IFNULL(b.Text, '') AS text, IFNULL(b.Annotation, '') AS note, IFNULL(b.DateCreated, '') AS date,
+  IFNULL(b.Type, '') AS type, IFNULL(b.ChapterProgress, 0) AS progress,
+  IFNULL((SELECT MIN(c.VolumeIndex) FROM content c WHERE c.ContentID LIKE b.ContentID || '%'), 0) AS chapter,
+  IFNULL((SELECT c.Title FROM content c WHERE c.ContentID LIKE b.ContentID || '%' ORDER BY c.VolumeIndex LIMIT 1), '') AS chapter_title
+FROM Bookmark b JOIN content v ON v.ContentID = b.VolumeID
+WHERE IFNULL(b.Hidden, 'false') != 'true'
+ORDER BY b.VolumeID, chapter, progress`
+
+// koboChapterSize is how far apart chapters are in the positions made
+// for Kobo's highlights, which only have a fraction through the chapter.
+const koboChapterSize = 1000
+
+// readKobo reads the annotations in a KoboReader.sqlite database.
+func readKobo(db string) (Clippings, error) {
+	rows, err := querySQLite(db, koboQuery)
+	if err != nil {
+		return nil, err
+	}
+	var clips Clippings
+	for _, row := range rows {
+		clip := Clipping{
+			uid:     row["id"],
+			title:   clipTitle(row["title"], row["author"]),
+			text:    row["text"],
+			chapter: row["chapter_title"],
+			date:    parseTime(row["date"], "2006-01-02T15:04:05.000", "2006-01-02T15:04:05Z", time.RFC3339),
+		}
+		switch row["type"] {
+		case "highlight", "note":
+			clip.kind = Highlight
+			if row["note"] != "" {
+				clip.notes = []string{row["note"]}
+			}
+		case "dogear":
+			clip.kind = Bookmark
+		default:
+			// Handwritten markups can't be shown
+			continue
+		}
+		chapter, _ := strconv.Atoi(row["chapter"])
+		progress, _ := strconv.ParseFloat(row["progress"], 64)
+		clip.start = chapter*koboChapterSize + int(progress*koboChapterSize)
+		clip.end = clip.start
+		clips = append(clips, clip)
+	}
+	return clips, nil
+}
@@ -0,0 +1,82 @@
+package kindle
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// koreaderBook is a book in KOReader's JSON export of highlights
+type koreaderBook struct {
+	Title   string          `json:"title"`
+	Author  string          `json:"author"`
+	Entries []koreaderEntry `json:"entries"`
+}
+
+type koreaderEntry struct {
+	Chapter string      `json:"chapter"`
+	Page    json.Number `json:"page"`
+	Time    int64       `json:"time"`
+	Sort    string      `json:"sort"`
+	Text    string      `json:"text"`
+	Note    string      `json:"note"`
+	Color   string      `json:"color"`
+}
+
+// readKOReader reads the highlights KOReader exported as JSON, either of
+// one book or of all of them.
+func readKOReader(fname string) (Clippings, error) {
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	var books []koreaderBook
+	var all struct {
+		Documents []koreaderBook `json:"documents"`
+	}
+	var one koreaderBook
+	switch {
+	case json.Unmarshal(data, &books) == nil:
+	case json.Unmarshal(data, &all) == nil && len(all.Documents) > 0:
+		books = all.Documents
+	default:
+		if err := json.Unmarshal(data, &one); err != nil {
+			return nil, fmt.Errorf("%s: %v", fname, err)
+		}
+		books = []koreaderBook{one}
+	}
+	var clips Clippings
+	for _, book := range books {
+		for _, entry := range book.Entries {
+			page, _ := strconv.Atoi(entry.Page.String())
+			clip := Clipping{
+				// There's no id, but a time and page are only used once
+				uid:     fmt.Sprintf("%d-%s", entry.Time, entry.Page),
+				title:   clipTitle(book.Title, book.Author),
+				page:    page,
+				start:   page,
+				end:     page,
+				date:    time.Unix(entry.Time, 0).UTC(),
+				text:    entry.Text,
+				chapter: entry.Chapter,
+				color:   entry.Color,
+			}
+			switch {
+			case entry.Sort == "bookmark":
+				clip.kind = Bookmark
+			case entry.Text == "" && entry.Note != "":
+				clip.kind = Note
+				clip.text = entry.Note
+			default:
+				clip.kind = Highlight
+				if entry.Note != "" {
+					clip.notes = []string{entry.Note}
+				}
+			}
+			clips = append(clips, clip)
+		}
+	}
+	return clips, nil
+}
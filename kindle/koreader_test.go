@@ -0,0 +1,49 @@
+package kindle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadKOReader(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "all-books.json")
+	export := `{"created_on": 1650000000, "version": "koreader", "documents": [
+  {"title": "Electrify", "author": "Saul Griffith", "entries": [
+    {"chapter": "One", "page": 12, "time": 1650000000, "sort": "highlight", "text": "Electrify everything", "note": "Even the stove"},
+    {"chapter": "One", "page": 12, "time": 1650000100, "sort": "highlight", "text": "Same page"}
+  ]}]}`
+	if err := os.WriteFile(fname, []byte(export), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Conf{}
+	if err := c.Read(fname); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.clippings) != 2 {
+		t.Fatalf("got %d clippings, want 2: %+v", len(c.clippings), c.clippings)
+	}
+	got := c.clippings[0]
+	if got.title != "Electrify (Saul Griffith)" || got.page != 12 || got.text != "Electrify everything" ||
+		len(got.notes) != 1 || got.notes[0] != "Even the stove" {
+		t.Errorf("first -> %+v", got)
+	}
+	if got.date.Location() != time.UTC || got.date.Format(time.RFC3339) != "2022-04-15T05:20:00Z" {
+		t.Errorf("date -> %v, want 2022-04-15T05:20:00Z in UTC", got.date)
+	}
+	if c.clippings[0].blockID() == c.clippings[1].blockID() {
+		t.Errorf("highlights on the same page have the same block ID %q", got.blockID())
+	}
+
+	// A single book
+	if err := os.WriteFile(fname, []byte(`{"title": "Dune", "author": "Frank Herbert", "entries": [{"page": 3, "time": 1, "text": "Fear"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Read(fname); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.clippings) != 1 || c.clippings[0].title != "Dune (Frank Herbert)" {
+		t.Errorf("single book -> %+v", c.clippings)
+	}
+}
@@ -0,0 +1,78 @@
+package kindle
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	// asinKey is the frontmatter key of a book note with its ASIN
+	asinKey = "asin"
+	// kindleURL opens the Kindle app at a location of the book
+	kindleURL = "kindle://book?action=open&asin=%s&location=%d"
+	// cloudURL opens the Kindle Cloud Reader at a location of the book
+	cloudURL = "https://read.amazon.com/?asin=%s&location=%d"
+)
+
+// rxASIN matches Amazon's 10 character ids, the ISBN-10 for printed books
+var rxASIN = regexp.MustCompile(`^[0-9A-Z]{10}$`)
+
+// readASINs reads the lines "Kindle title => ASIN" from c.ASINFile.
+func (c *Conf) readASINs() error {
+	pairs, err := readPairs(c.ASINFile)
+	if err != nil {
+		return err
+	}
+	c.asins = map[string]string{}
+	for title, asin := range pairs {
+		if asin = cleanASIN(asin); asin == "" {
+			fmt.Printf("Ignoring ASIN %q for %q in %q\n", pairs[title], title, c.ASINFile)
+			continue
+		}
+		c.asins[title] = asin
+	}
+	return nil
+}
+
+// cleanASIN returns asin in upper case, or "" if it isn't one
+func cleanASIN(asin string) string {
+	asin = strings.ToUpper(strings.TrimSpace(asin))
+	if !rxASIN.MatchString(asin) {
+		return ""
+	}
+	return asin
+}
+
+// asin returns the ASIN of clipTitle from c.ASINFile, or else the one in
+// the frontmatter of fname, its note. It's "" if neither has one.
+func (c *Conf) asin(clipTitle, fname string) string {
+	if asin, ok := c.asins[clipTitle]; ok {
+		return asin
+	}
+	return c.noteASINs[fname]
+}
+
+// withASIN returns clips with the ASIN of the book of fname set on the
+// ones from a Kindle, which locations the links can go to.
+func (c *Conf) withASIN(fname string, clips []Clipping) []Clipping {
+	ret := make([]Clipping, len(clips))
+	for i, clip := range clips {
+		if clip.uid == "" {
+			clip.asin = c.asin(clip.title, fname)
+		}
+		ret[i] = clip
+	}
+	return ret
+}
+
+// links returns the URLs that open the Kindle app and Cloud Reader at the
+// clipping, or "" if its ASIN isn't known.
+func (clip Clipping) links() (kindle, cloud string) {
+	if clip.asin == "" {
+		return "", ""
+	}
+	asin := url.QueryEscape(clip.asin)
+	return fmt.Sprintf(kindleURL, asin, clip.start), fmt.Sprintf(cloudURL, asin, clip.start)
+}
@@ -0,0 +1,64 @@
+package kindle
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestASIN(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, txt string) string {
+		fname := filepath.Join(dir, name)
+		if err := os.WriteFile(fname, []byte(txt), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return fname
+	}
+	noted := write("Noted.md", "---\ntitle: Noted\nasin: b00noted01\n---\n")
+	mapped := write("Mapped.md", "---\ntitle: Mapped\nasin: B00IGNORED\n---\n")
+	write(".kindle-asins", "# Kindle title => ASIN\nMapped (Someone) => B00MAPPED1\nBad (Someone) => not-an-asin\n")
+	c := NewConf("", dir)
+	if err := c.LookupExisting(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		title, fname string
+		want         string
+	}{
+		{"Noted (Someone)", noted, "B00NOTED01"},
+		{"Mapped (Someone)", mapped, "B00MAPPED1"},
+		{"Bad (Someone)", filepath.Join(dir, "Bad.md"), ""},
+	}
+	for _, test := range tests {
+		if got := c.asin(test.title, test.fname); got != test.want {
+			t.Errorf("asin(%q) = %q, want %q", test.title, got, test.want)
+		}
+	}
+
+	// Only the Kindle's locations can be linked to
+	clips := c.withASIN(noted, []Clipping{
+		{title: "Noted (Someone)", start: 98, end: 99},
+		{title: "Noted (Someone)", start: 98, end: 99, uid: "kobo-1"},
+	})
+	if clips[0].asin != "B00NOTED01" || clips[1].asin != "" {
+		t.Errorf("withASIN -> %q, %q, want B00NOTED01 and none", clips[0].asin, clips[1].asin)
+	}
+	kindle, cloud := clips[0].links()
+	if want := "kindle://book?action=open&asin=B00NOTED01&location=98"; kindle != want {
+		t.Errorf("links -> %q, want %q", kindle, want)
+	}
+	if want := "https://read.amazon.com/?asin=B00NOTED01&location=98"; cloud != want {
+		t.Errorf("links -> %q, want %q", cloud, want)
+	}
+	for _, name := range BlockTemplates {
+		c := &Conf{BlockTemplate: name}
+		if got := mustRender(t, c, clips[0]); !strings.Contains(got, "("+kindle+")") || !strings.Contains(got, "("+cloud+")") {
+			t.Errorf("%s has no links in %q", name, got)
+		}
+		if got := mustRender(t, c, clips[1]); strings.Contains(got, "kindle://") {
+			t.Errorf("%s has links without an ASIN in %q", name, got)
+		}
+	}
+}
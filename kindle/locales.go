@@ -0,0 +1,190 @@
+package kindle
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// locale is how a Kindle set to one language writes the metadata line
+// under the title of each clipping.
+type locale struct {
+	lang string
+
+	// meta are tried in order, they use the named groups
+	// kind, page (optional), start, end (optional) and date.
+	meta []*regexp.Regexp
+
+	// kinds maps the lower case kind word to a Kind
+	kinds map[string]Kind
+
+	// months are the lower case month names starting with January,
+	// they are made English before the date is parsed with layouts.
+	// Empty for English.
+	months []string
+
+	layouts []string
+}
+
+// locales is the table of formats Read understands, add to it
+// to support another language.
+var locales = []locale{
+	{
+		lang: "en",
+		meta: []*regexp.Regexp{
+			// Ex. "- Your Highlight on page 190 | Location 1870-1871 | Added on Friday, April 15, 2022 12:24:16 AM"
+			regexp.MustCompile(`^- Your (?P<kind>Highlight|Note|Bookmark) on page (?P<page>\d+) \| Location (?P<start>\d+)(?:-(?P<end>\d+))? \| Added on (?P<date>.+)$`),
+			// Ex. "- Your Highlight at location 1234-1240 | Added on Friday, April 15, 2022 12:24:16 AM"
+			regexp.MustCompile(`^- Your (?P<kind>Highlight|Note|Bookmark) (?:at|on) [Ll]ocation (?P<start>\d+)(?:-(?P<end>\d+))? \| Added on (?P<date>.+)$`),
+		},
+		kinds: map[string]Kind{"highlight": Highlight, "note": Note, "bookmark": Bookmark},
+		layouts: []string{
+			"Monday, January 2, 2006 3:04:05 PM",
+			"Monday, 2 January 2006 15:04:05",
+		},
+	},
+	{
+		lang: "fr",
+		meta: []*regexp.Regexp{
+			// Ex. "- Votre surlignement sur la page 12 | emplacement 150-152 | Ajouté le samedi 11 décembre 2021 13:17:08"
+			regexp.MustCompile(`^- Votre (?P<kind>surlignement|note|signet) sur la page (?P<page>\d+) \| emplacement (?P<start>\d+)(?:-(?P<end>\d+))? \| Ajouté le (?:\p{L}+ )?(?P<date>.+)$`),
+			regexp.MustCompile(`^- Votre (?P<kind>surlignement|note|signet) à l['’]emplacement (?P<start>\d+)(?:-(?P<end>\d+))? \| Ajouté le (?:\p{L}+ )?(?P<date>.+)$`),
+		},
+		kinds: map[string]Kind{"surlignement": Highlight, "note": Note, "signet": Bookmark},
+		months: []string{
+			"janvier", "février", "mars", "avril", "mai", "juin",
+			"juillet", "août", "septembre", "octobre", "novembre", "décembre",
+		},
+		layouts: []string{"2 January 2006 15:04:05"},
+	},
+	{
+		lang: "it",
+		meta: []*regexp.Regexp{
+			// Ex. "- La tua evidenziazione a pagina 12 | posizione 150-152 | Aggiunto in data sabato 11 dicembre 2021 13:17:08"
+			regexp.MustCompile(`^- (?:La tua|Il tuo) (?P<kind>evidenziazione|nota|segnalibro) a pagina (?P<page>\d+) \| posizione (?P<start>\d+)(?:-(?P<end>\d+))? \| Aggiunto in data (?:\p{L}+ )?(?P<date>.+)$`),
+			regexp.MustCompile(`^- (?:La tua|Il tuo) (?P<kind>evidenziazione|nota|segnalibro) (?:alla|in) posizione (?P<start>\d+)(?:-(?P<end>\d+))? \| Aggiunto in data (?:\p{L}+ )?(?P<date>.+)$`),
+		},
+		kinds: map[string]Kind{"evidenziazione": Highlight, "nota": Note, "segnalibro": Bookmark},
+		months: []string{
+			"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno",
+			"luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre",
+		},
+		layouts: []string{"2 January 2006 15:04:05"},
+	},
+	{
+		lang: "es",
+		meta: []*regexp.Regexp{
+			// Ex. "- Tu subrayado en la página 12 | posición 150-152 | Añadido el sábado, 11 de diciembre de 2021 13:17:08"
+			regexp.MustCompile(`^- Tu (?P<kind>subrayado|nota|marcador) en la página (?P<page>\d+) \| posición (?P<start>\d+)(?:-(?P<end>\d+))? \| Añadido el (?:\p{L}+, )?(?P<date>.+)$`),
+			regexp.MustCompile(`^- Tu (?P<kind>subrayado|nota|marcador) en la posición (?P<start>\d+)(?:-(?P<end>\d+))? \| Añadido el (?:\p{L}+, )?(?P<date>.+)$`),
+		},
+		kinds: map[string]Kind{"subrayado": Highlight, "nota": Note, "marcador": Bookmark},
+		months: []string{
+			"enero", "febrero", "marzo", "abril", "mayo", "junio",
+			"julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre",
+		},
+		layouts: []string{"2 de January de 2006 15:04:05"},
+	},
+	{
+		lang: "de",
+		meta: []*regexp.Regexp{
+			// Ex. "- Ihre Markierung auf Seite 12 | Position 150-152 | Hinzugefügt am Samstag, 11. Dezember 2021 13:17:08"
+			regexp.MustCompile(`^- Ihre? (?P<kind>Markierung|Notiz|Lesezeichen) auf Seite (?P<page>\d+) \| Position (?P<start>\d+)(?:-(?P<end>\d+))? \| Hinzugefügt am (?:\p{L}+, )?(?P<date>.+)$`),
+			regexp.MustCompile(`^- Ihre? (?P<kind>Markierung|Notiz|Lesezeichen) (?:bei|an) Position (?P<start>\d+)(?:-(?P<end>\d+))? \| Hinzugefügt am (?:\p{L}+, )?(?P<date>.+)$`),
+		},
+		kinds: map[string]Kind{"markierung": Highlight, "notiz": Note, "lesezeichen": Bookmark},
+		months: []string{
+			"januar", "februar", "märz", "april", "mai", "juni",
+			"juli", "august", "september", "oktober", "november", "dezember",
+		},
+		layouts: []string{"2. January 2006 15:04:05"},
+	},
+}
+
+// ParseError is a line of the clippings file that couldn't be understood.
+type ParseError struct {
+	Line int // Counting from one
+	Text string
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %v: %q", e.Line, e.Err, e.Text)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ParseErrors are all the clippings that were skipped while reading.
+type ParseErrors []*ParseError
+
+func (e ParseErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%d clippings skipped, first at %v", len(e), e[0])
+}
+
+// parseMeta fills in the clipping from the metadata line using the
+// first locale that matches it.
+func (c *Clipping) parseMeta(line string) error {
+	for _, loc := range locales {
+		for _, rx := range loc.meta {
+			matches := rx.FindStringSubmatch(line)
+			if matches == nil {
+				continue
+			}
+			return c.fromMatches(loc, rx, matches)
+		}
+	}
+	return fmt.Errorf("unknown clipping format")
+}
+
+func (c *Clipping) fromMatches(loc locale, rx *regexp.Regexp, matches []string) error {
+	group := func(name string) string {
+		if i := rx.SubexpIndex(name); i >= 0 {
+			return matches[i]
+		}
+		return ""
+	}
+	var err error
+	c.kind = loc.kinds[strings.ToLower(group("kind"))]
+	if page := group("page"); page != "" {
+		if c.page, err = toInt(page); err != nil {
+			return err
+		}
+	}
+	if c.start, err = toInt(group("start")); err != nil {
+		return err
+	}
+	c.end = c.start
+	if end := group("end"); end != "" {
+		if c.end, err = toInt(end); err != nil {
+			return err
+		}
+	}
+	c.date, err = loc.parseDate(group("date"))
+	return err
+}
+
+// parseDate tries each of the layouts after translating the month name.
+func (loc locale) parseDate(txt string) (time.Time, error) {
+	txt = strings.TrimSpace(txt)
+	if len(loc.months) > 0 {
+		txt = strings.ToLower(txt)
+		for i, month := range loc.months {
+			if strings.Contains(txt, month) {
+				txt = strings.Replace(txt, month, time.Month(i+1).String(), 1)
+				break
+			}
+		}
+	}
+	for _, layout := range loc.layouts {
+		if t, err := time.Parse(layout, txt); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unable to parse %s date %q", loc.lang, txt)
+}
@@ -0,0 +1,255 @@
+package kindle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/scottkirkwood/obsidian/normalize"
+)
+
+// bookNote is an existing note that clippings can be added to.
+// All the names are normalized, see normalize.Text.
+type bookNote struct {
+	fname  string
+	title  string
+	short  string // title without subtitle
+	author string
+}
+
+// candidate is a bookNote and how similar it is to a clipping title.
+type candidate struct {
+	note  *bookNote
+	score float64
+}
+
+const aliasSep = " => "
+
+func newBookNote(fname, title, shortTitle, author string) *bookNote {
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(fname), filepath.Ext(fname))
+	}
+	full, short := splitSubtitle(title)
+	if shortTitle != "" {
+		short = normalize.Text(shortTitle)
+	}
+	return &bookNote{
+		fname:  fname,
+		title:  full,
+		short:  short,
+		author: normalize.Author(author),
+	}
+}
+
+// splitClipTitle splits a Kindle title like "Electrify (Griffith, Saul)"
+// into its title and author.
+func splitClipTitle(clipTitle string) (title, author string) {
+	clipTitle = strings.TrimSpace(clipTitle)
+	if !strings.HasSuffix(clipTitle, ")") {
+		return clipTitle, ""
+	}
+	idx := strings.LastIndex(clipTitle, "(")
+	if idx == -1 {
+		return clipTitle, ""
+	}
+	return strings.TrimSpace(clipTitle[:idx]), strings.TrimSpace(clipTitle[idx+1 : len(clipTitle)-1])
+}
+
+// splitSubtitle returns the normalized full title, without repeated
+// parts like "Scary Smart: Scary Smart: The Future", and the part before
+// the subtitle.
+func splitSubtitle(title string) (full, short string) {
+	title = strings.NewReplacer("–", ":", "—", ":", " - ", ":").Replace(title)
+	var parts []string
+	for _, part := range strings.Split(title, ":") {
+		part = normalize.Text(part)
+		if part == "" || (len(parts) > 0 && parts[len(parts)-1] == part) {
+			continue
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return "", ""
+	}
+	return strings.Join(parts, " "), parts[0]
+}
+
+// similarity is the Dice coefficient of the letter pairs of a and b.
+func similarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	pairs := func(s string) map[string]int {
+		runes := []rune(s)
+		m := map[string]int{}
+		for i := 0; i+1 < len(runes); i++ {
+			m[string(runes[i:i+2])]++
+		}
+		return m
+	}
+	pa, pb := pairs(a), pairs(b)
+	total, common := 0, 0
+	for pair, n := range pa {
+		total += n
+		if m := pb[pair]; m < n {
+			common += m
+		} else {
+			common += n
+		}
+	}
+	for _, n := range pb {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	return 2 * float64(common) / float64(total)
+}
+
+// score returns how similar the note is to the title and author of a
+// clipping, between 0 and 1.
+func (n *bookNote) score(title, author string) float64 {
+	full, short := splitSubtitle(title)
+	titleScore := similarity(full, n.title)
+	if s := similarity(short, n.short); s > titleScore {
+		titleScore = s
+	}
+	author = normalize.Author(author)
+	if author == "" || n.author == "" {
+		return titleScore
+	}
+	return 0.8*titleScore + 0.2*similarity(author, n.author)
+}
+
+// rank returns the notes sorted from most to least similar to clipTitle.
+func (c *Conf) rank(clipTitle string) []candidate {
+	title, author := splitClipTitle(clipTitle)
+	ret := make([]candidate, 0, len(c.existing))
+	for _, note := range c.existing {
+		ret = append(ret, candidate{note, note.score(title, author)})
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].score > ret[j].score
+	})
+	return ret
+}
+
+// match returns the files for clipTitle, using the aliases first then
+// the notes at least as similar as c.Threshold.
+// Several files are returned when they are equally good.
+func (c *Conf) match(clipTitle string) []string {
+	if fname, ok := c.aliases[clipTitle]; ok {
+		return []string{filepath.Join(c.outputDir, fname)}
+	}
+	candidates := c.rank(clipTitle)
+	var fnames []string
+	for _, cand := range candidates {
+		if cand.score < c.Threshold || cand.score < candidates[0].score {
+			break
+		}
+		fnames = append(fnames, cand.note.fname)
+	}
+	if len(fnames) == 1 || !c.Resolve {
+		if len(fnames) == 0 {
+			fmt.Printf("Not found %q\n", clipTitle)
+			if len(candidates) > 0 {
+				fmt.Printf("  closest %q (%.2f)\n", candidates[0].note.fname, candidates[0].score)
+			}
+		}
+		return fnames
+	}
+	fname, err := c.ask(clipTitle, candidates)
+	if err != nil {
+		fmt.Printf("Unable to resolve %q: %v\n", clipTitle, err)
+		return fnames
+	}
+	if fname == "" {
+		return fnames
+	}
+	return []string{fname}
+}
+
+// ask prompts for which of the candidates clipTitle belongs to and
+// records the answer in the alias file.
+func (c *Conf) ask(clipTitle string, candidates []candidate) (string, error) {
+	const maxChoices = 5
+	fmt.Printf("Which note is %q?\n", clipTitle)
+	for i, cand := range candidates {
+		if i == maxChoices {
+			candidates = candidates[:i]
+			break
+		}
+		fmt.Printf("  %d) %s (%.2f)\n", i+1, cand.note.fname, cand.score)
+	}
+	fmt.Printf("Number, or enter to skip: ")
+	answer, err := c.stdin.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return "", nil
+	}
+	num, err := toInt(answer)
+	if err != nil || num < 1 || num > len(candidates) {
+		return "", fmt.Errorf("no choice %q", answer)
+	}
+	fname := candidates[num-1].note.fname
+	return fname, c.addAlias(clipTitle, fname)
+}
+
+// readAliases reads the lines "Kindle title => note.md" from c.AliasFile,
+// the note being relative to c.outputDir.
+func (c *Conf) readAliases() (err error) {
+	c.aliases, err = readPairs(c.AliasFile)
+	return err
+}
+
+// readPairs reads the lines "key => value" of fname, which doesn't have to
+// exist. Blank lines and those starting with # are skipped.
+func readPairs(fname string) (map[string]string, error) {
+	pairs := map[string]string{}
+	file, err := os.Open(fname)
+	if os.IsNotExist(err) {
+		return pairs, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, aliasSep, 2)
+		if len(parts) != 2 {
+			fmt.Printf("Ignoring %q in %q\n", line, fname)
+			continue
+		}
+		pairs[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return pairs, scanner.Err()
+}
+
+func (c *Conf) addAlias(clipTitle, fname string) error {
+	rel, err := filepath.Rel(c.outputDir, fname)
+	if err != nil {
+		return err
+	}
+	c.aliases[clipTitle] = rel
+	if c.DryRun {
+		return nil
+	}
+	file, err := os.OpenFile(c.AliasFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = fmt.Fprintf(file, "%s%s%s\n", clipTitle, aliasSep, rel)
+	return err
+}
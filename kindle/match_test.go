@@ -0,0 +1,76 @@
+package kindle
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitClipTitle(t *testing.T) {
+	tests := []struct {
+		in, title, author string
+	}{
+		{"Electrify (Griffith, Saul)", "Electrify", "Griffith, Saul"},
+		{"No author", "No author", ""},
+		{"Title (Series 1) (Author, An)", "Title (Series 1)", "Author, An"},
+	}
+	for _, test := range tests {
+		title, author := splitClipTitle(test.in)
+		if title != test.title || author != test.author {
+			t.Errorf("%q -> %q, %q, want %q, %q\n", test.in, title, author, test.title, test.author)
+		}
+	}
+}
+
+func TestSplitSubtitle(t *testing.T) {
+	full, short := splitSubtitle("Scary Smart: Scary Smart: The Future of AI")
+	if full != "scary smart the future of ai" || short != "scary smart" {
+		t.Errorf("got %q, %q", full, short)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	dir := t.TempDir()
+	c := NewConf("", dir)
+	c.matched = map[string][]string{}
+	c.aliases = map[string]string{}
+	c.existing = []*bookNote{
+		newBookNote(filepath.Join(dir, "Scary Smart.md"), "Scary Smart", "", "Gawdat, Mo"),
+		newBookNote(filepath.Join(dir, "Electrify.md"), "Electrify: An Optimist's Playbook for Our Clean Energy Future", "Electrify", "Griffith, Saul"),
+		newBookNote(filepath.Join(dir, "Twin A.md"), "Twin", "", ""),
+		newBookNote(filepath.Join(dir, "Twin B.md"), "Twin", "", ""),
+	}
+	tests := []struct {
+		title string
+		want  []string
+	}{
+		{"Scary Smart: Scary Smart: The Future of Artificial Intelligence (Gawdat, Mo)", []string{"Scary Smart.md"}},
+		{"Electrify (Griffith, Saul)", []string{"Electrify.md"}},
+		{"Elektrify (Saul Griffith)", []string{"Electrify.md"}},
+		{"Twin", []string{"Twin A.md", "Twin B.md"}},
+		{"Something Else Entirely (Nobody)", nil},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, fname := range c.match(test.title) {
+			got = append(got, filepath.Base(fname))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q -> %q, want %q", test.title, got, test.want)
+		}
+	}
+
+	if err := c.addAlias("Something Else Entirely (Nobody)", filepath.Join(dir, "Twin A.md")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.readAliases(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.match("Something Else Entirely (Nobody)"), []string{filepath.Join(dir, "Twin A.md")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("alias -> %q, want %q", got, want)
+	}
+	if _, err := os.Stat(c.AliasFile); err != nil {
+		t.Errorf("alias file not written: %v", err)
+	}
+}
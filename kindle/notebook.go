@@ -0,0 +1,154 @@
+package kindle
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/scottkirkwood/obsidian/htmlutil"
+	"golang.org/x/net/html"
+)
+
+// rxNoteHeading parses the heading of each highlight in the notebook, like
+// "Highlight(yellow) - Chapter 1 > Page 5 · Location 98"
+var rxNoteHeading = regexp.MustCompile(`^(?i)(?P<kind>highlight|note|bookmark)\s*(?:\((?P<color>[^)]*)\))?\s*-\s*(?:.*>\s*)?(?:Page\s+(?P<page>[0-9]+)\D*?)?(?:Location\s+(?P<start>[0-9]+)(?:-(?P<end>[0-9]+))?)?\s*$`)
+
+// notebookNoteSpan is how many locations after the start of a highlight a
+// note can be and still be on it, the notebook only has where they start.
+const notebookNoteSpan = 10
+
+// readNotebook reads the HTML that Kindle's Export Notebook emails.
+func readNotebook(fname string) (Clippings, error) {
+	file, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseNotebook(file)
+}
+
+// parseNotebook reads the notebook from r. It's a list of divs with a class
+// for what they are, the book title and authors, then a sectionHeading for
+// each chapter and a noteHeading and noteText for each highlight or note.
+// The divs aren't always closed, so each one ends at the next.
+// Notes follow the highlight they were made on, so they're attached to it.
+func parseNotebook(r io.Reader) (Clippings, error) {
+	var (
+		clips                Clippings
+		class                string
+		text                 strings.Builder
+		bookTitle, authors   string
+		chapter, noteHeading string
+		haveHeading          bool
+		errs                 ParseErrors
+		// lineNo is the line the tokenizer is at, headingLine where the
+		// last noteHeading started
+		lineNo, headingLine = 1, 0
+	)
+	// done handles the text of the div that just ended
+	done := func() {
+		txt := strings.Join(strings.Fields(text.String()), " ")
+		text.Reset()
+		switch class {
+		case "bookTitle":
+			bookTitle = txt
+		case "authors":
+			authors = txt
+		case "sectionHeading":
+			chapter = txt
+		case "noteHeading":
+			noteHeading, haveHeading = txt, true
+		case "noteText":
+			if !haveHeading {
+				return
+			}
+			haveHeading = false
+			clip := Clipping{title: clipTitle(bookTitle, authors), chapter: chapter, text: txt}
+			if err := clip.parseNoteHeading(noteHeading); err != nil {
+				errs = append(errs, &ParseError{Line: headingLine, Text: noteHeading, Err: err})
+				return
+			}
+			if clip.kind == Note && len(clips) > 0 {
+				last := &clips[len(clips)-1]
+				if last.kind == Highlight && last.title == clip.title && clip.start >= last.start && clip.start <= last.end+notebookNoteSpan {
+					last.notes = append(last.notes, clip.text)
+					return
+				}
+			}
+			clips = append(clips, clip)
+		}
+	}
+	z := html.NewTokenizer(r)
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		line := lineNo
+		lineNo += strings.Count(string(z.Raw()), "\n")
+		tok := z.Token()
+		switch tt {
+		case html.StartTagToken:
+			if tok.Data == "div" || tok.Data == "h2" || tok.Data == "h3" {
+				done()
+				class = htmlutil.Attr(tok, "class")
+				if class == "noteHeading" {
+					headingLine = line
+				}
+			}
+		case html.TextToken:
+			text.WriteString(tok.Data)
+		}
+	}
+	done()
+	if err := z.Err(); err != nil && err != io.EOF {
+		return clips, err
+	}
+	if len(errs) > 0 {
+		return clips, errs
+	}
+	return clips, nil
+}
+
+// parseNoteHeading fills in the kind, color and location of the clipping
+// from a notebook's noteHeading.
+func (c *Clipping) parseNoteHeading(heading string) error {
+	matches := rxNoteHeading.FindStringSubmatch(heading)
+	if matches == nil {
+		return fmt.Errorf("unknown note heading")
+	}
+	group := func(name string) string {
+		return matches[rxNoteHeading.SubexpIndex(name)]
+	}
+	switch strings.ToLower(group("kind")) {
+	case "note":
+		c.kind = Note
+	case "bookmark":
+		c.kind = Bookmark
+	default:
+		c.kind = Highlight
+	}
+	c.color = strings.ToLower(group("color"))
+	var err error
+	if page := group("page"); page != "" {
+		if c.page, err = toInt(page); err != nil {
+			return err
+		}
+	}
+	if start := group("start"); start != "" {
+		if c.start, err = toInt(start); err != nil {
+			return err
+		}
+	} else {
+		c.start = c.page
+	}
+	c.end = c.start
+	if end := group("end"); end != "" {
+		if c.end, err = toInt(end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
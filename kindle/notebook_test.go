@@ -0,0 +1,54 @@
+package kindle
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testNotebook is like Kindle's Export Notebook, which doesn't close all
+// of its divs.
+const testNotebook = `<html><body><div class="bodyContainer">
+<div class="notebookFor">Notebook Export</div>
+<div class="bookTitle">Zero to One
+</div>
+<div class="authors">Thiel, Peter</div>
+<div class="citation">Thiel, Peter. Zero to One. Crown, 2014.</div>
+<hr/>
+<div class="sectionHeading">Preface</div>
+<div class="noteHeading">Highlight(<span class="highlight_yellow">yellow</span>) - Page 5 · Location 98</div>
+<div class="noteText">Every moment in business
+ happens only once.</h3>
+<div class="noteHeading">Note - Page 5 · Location 100</div>
+<div class="noteText">So true</div>
+<div class="sectionHeading">1 The Challenge of the Future</div>
+<div class="noteHeading">Highlight(<span class="highlight_blue">blue</span>) - 1 The Challenge > Page 12 · Location 180</div>
+<div class="noteText">What important truth do very few people agree with you on?</div>
+<div class="noteHeading">Bookmark - Location 200</div>
+<div class="noteText"></div>
+<div class="noteHeading">Something else</div>
+<div class="noteText">Skipped</div>
+</div></body></html>`
+
+func TestParseNotebook(t *testing.T) {
+	clips, err := parseNotebook(strings.NewReader(testNotebook))
+	var parseErrs ParseErrors
+	if !errors.As(err, &parseErrs) || len(parseErrs) != 1 || parseErrs[0].Line != 19 {
+		t.Errorf("parseNotebook error -> %v, want one at line 19", err)
+	}
+	if len(clips) != 3 {
+		t.Fatalf("got %d clippings, want 3: %+v", len(clips), clips)
+	}
+	got := clips[0]
+	if got.title != "Zero to One (Thiel, Peter)" || got.chapter != "Preface" || got.color != "yellow" ||
+		got.page != 5 || got.start != 98 || got.text != "Every moment in business happens only once." ||
+		len(got.notes) != 1 || got.notes[0] != "So true" {
+		t.Errorf("first -> %+v", got)
+	}
+	if got := clips[1]; got.chapter != "1 The Challenge of the Future" || got.color != "blue" || got.page != 12 || got.start != 180 {
+		t.Errorf("second -> %+v", got)
+	}
+	if got := clips[2]; got.kind != Bookmark || got.start != 200 {
+		t.Errorf("bookmark -> %+v", got)
+	}
+}
@@ -0,0 +1,179 @@
+package kindle
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	// The SQLite driver, in Go so nothing else has to be installed
+	_ "modernc.org/sqlite"
+)
+
+// Formats of the files highlights can be read from
+const (
+	FormatClippings = "clippings" // Kindle's My Clippings.txt
+	FormatKobo      = "kobo"      // Kobo's KoboReader.sqlite
+	FormatApple     = "apple"     // Apple Books' AEAnnotation sqlite database
+	FormatKOReader  = "koreader"  // KOReader's JSON export
+	FormatNotebook  = "notebook"  // The HTML of Kindle's Export Notebook
+)
+
+// Formats are all the formats Read understands
+var Formats = []string{FormatClippings, FormatNotebook, FormatKobo, FormatApple, FormatKOReader}
+
+// detectFormat guesses the format of fname from its name.
+func detectFormat(fname string) (string, error) {
+	base := strings.ToLower(filepath.Base(fname))
+	switch filepath.Ext(base) {
+	case ".json":
+		return FormatKOReader, nil
+	case ".html", ".htm":
+		return FormatNotebook, nil
+	case ".sqlite", ".sqlite3", ".db":
+		switch {
+		case strings.Contains(base, "kobo"):
+			return FormatKobo, nil
+		case strings.Contains(base, "aeannotation"):
+			return FormatApple, nil
+		}
+		return "", fmt.Errorf("unknown database %q, give its format, one of %q", fname, Formats)
+	}
+	return FormatClippings, nil
+}
+
+// Read reads the clippings from fname in c.Format, or the format its name
+// suggests if that's empty.
+func (c *Conf) Read(fname string) error {
+	format := c.Format
+	if format == "" {
+		var err error
+		if format, err = detectFormat(fname); err != nil {
+			return err
+		}
+	}
+	var clips Clippings
+	var err error
+	switch format {
+	case FormatClippings:
+		file, err := os.Open(fname)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		return c.parse(file)
+	case FormatKobo:
+		clips, err = readKobo(fname)
+	case FormatApple:
+		clips, err = readAppleBooks(fname)
+	case FormatKOReader:
+		clips, err = readKOReader(fname)
+	case FormatNotebook:
+		clips, err = readNotebook(fname)
+	default:
+		return fmt.Errorf("unknown format %q, use one of %q", format, Formats)
+	}
+	// Clippings that could be read are kept even with ParseErrors
+	c.clippings = clips.attachNotes()
+	return err
+}
+
+// querySQLite runs query on the database db, opened read only, and returns
+// the rows by column name. The setup statements, like ATTACH, are run on
+// the same connection first.
+func querySQLite(db, query string, setup ...string) ([]map[string]string, error) {
+	abs, err := filepath.Abs(db)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(abs); err != nil {
+		return nil, err
+	}
+	dsn := (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs), RawQuery: "mode=ro"}).String()
+	handle, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", db, err)
+	}
+	defer handle.Close()
+	// ATTACH only lasts as long as its connection
+	handle.SetMaxOpenConns(1)
+	for _, stmt := range setup {
+		if _, err := handle.Exec(stmt); err != nil {
+			return nil, fmt.Errorf("%s: %v", db, err)
+		}
+	}
+	rows, err := handle.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", db, err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var ret []map[string]string
+	for rows.Next() {
+		vals := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return ret, fmt.Errorf("%s: %v", db, err)
+		}
+		row := map[string]string{}
+		for i, name := range columns {
+			row[name] = sqlString(vals[i])
+		}
+		ret = append(ret, row)
+	}
+	return ret, rows.Err()
+}
+
+// sqlString formats a value read from SQLite, NULL is "".
+func sqlString(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprint(val)
+}
+
+// sqlQuote quotes txt as an SQL string
+func sqlQuote(txt string) string {
+	return "'" + strings.ReplaceAll(txt, "'", "''") + "'"
+}
+
+// clipTitle makes a title like the Kindle's, "Electrify (Griffith, Saul)",
+// so they're matched to notes the same way.
+func clipTitle(title, author string) string {
+	title, author = strings.TrimSpace(title), strings.TrimSpace(author)
+	if author == "" {
+		return title
+	}
+	return fmt.Sprintf("%s (%s)", title, author)
+}
+
+// parseTime tries each of the layouts, returning the zero time if none work.
+func parseTime(txt string, layouts ...string) time.Time {
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, txt); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,101 @@
+package kindle
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"My Clippings.txt", FormatClippings},
+		{"/media/KOBOeReader/.kobo/KoboReader.sqlite", FormatKobo},
+		{"AEAnnotation_v10312011_1727_local.sqlite", FormatApple},
+		{"highlights.json", FormatKOReader},
+		{"other.sqlite", ""},
+	}
+	for _, test := range tests {
+		got, err := detectFormat(test.in)
+		if got != test.want || (err != nil) != (test.want == "") {
+			t.Errorf("%q -> %q, %v, want %q\n", test.in, got, err, test.want)
+		}
+	}
+}
+
+// makeDB makes the sqlite database fname from the sql.
+func makeDB(t *testing.T, fname, query string) {
+	if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite", fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(query); err != nil {
+		t.Fatalf("%s: %v", fname, err)
+	}
+}
+
+func TestReadKobo(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "KoboReader.sqlite")
+	makeDB(t, db, `
+CREATE TABLE content (ContentID TEXT, Title TEXT, Attribution TEXT, VolumeIndex INTEGER);
+CREATE TABLE Bookmark (BookmarkID TEXT, VolumeID TEXT, ContentID TEXT, Text TEXT, Annotation TEXT,
+  DateCreated TEXT, Type TEXT, ChapterProgress REAL, Hidden TEXT);
+INSERT INTO content VALUES ('book', 'Electrify', 'Saul Griffith', 0), ('book#ch2.html', 'Chapter 2', NULL, 2);
+INSERT INTO Bookmark VALUES
+  ('b1', 'book', 'book#ch2.html', 'Electrify everything', 'Even the stove', '2022-01-02T03:04:05.000', 'note', 0.5, 'false'),
+  ('b2', 'book', 'book#ch2.html', NULL, NULL, '2022-01-03T03:04:05Z', 'dogear', 0.75, 'false'),
+  ('b3', 'book', 'book#ch2.html', 'Deleted', NULL, '2022-01-03T03:04:05Z', 'highlight', 0.8, 'true');`)
+	c := &Conf{Format: FormatKobo}
+	if err := c.Read(db); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.clippings) != 2 {
+		t.Fatalf("got %d clippings, want 2: %+v", len(c.clippings), c.clippings)
+	}
+	got := c.clippings[0]
+	if got.title != "Electrify (Saul Griffith)" || got.kind != Highlight || got.text != "Electrify everything" ||
+		len(got.notes) != 1 || got.notes[0] != "Even the stove" || got.start != 2500 || got.date.Day() != 2 {
+		t.Errorf("highlight -> %+v", got)
+	}
+	if got := c.clippings[1]; got.kind != Bookmark || got.start != 2750 {
+		t.Errorf("bookmark -> %+v", got)
+	}
+}
+
+func TestReadAppleBooks(t *testing.T) {
+	docs := t.TempDir()
+	db := filepath.Join(docs, "AEAnnotation", "AEAnnotation_v10312011_1727_local.sqlite")
+	makeDB(t, db, `
+CREATE TABLE ZAEANNOTATION (ZANNOTATIONUUID TEXT, ZANNOTATIONASSETID TEXT, ZANNOTATIONSELECTEDTEXT TEXT,
+  ZANNOTATIONNOTE TEXT, ZANNOTATIONCREATIONDATE REAL, ZPLLOCATIONRANGESTART INTEGER, ZPLLOCATIONRANGEEND INTEGER,
+  ZANNOTATIONDELETED INTEGER);
+INSERT INTO ZAEANNOTATION VALUES
+  ('u1', 'A1', 'A quote', 'My thought', 86400, 10, 12, 0),
+  ('u2', 'A1', NULL, 'Just a note', 86400, 20, 20, 0),
+  ('u3', 'A1', 'Gone', NULL, 86400, 30, 31, 1);`)
+	makeDB(t, filepath.Join(docs, "BKLibrary", "BKLibrary-1-091020131601.sqlite"), `
+CREATE TABLE ZBKLIBRARYASSET (ZASSETID TEXT, ZTITLE TEXT, ZAUTHOR TEXT);
+INSERT INTO ZBKLIBRARYASSET VALUES ('A1', 'Zero to One', 'Peter Thiel');`)
+	c := &Conf{}
+	if err := c.Read(db); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.clippings) != 2 {
+		t.Fatalf("got %d clippings, want 2: %+v", len(c.clippings), c.clippings)
+	}
+	got := c.clippings[0]
+	if got.title != "Zero to One (Peter Thiel)" || got.kind != Highlight || got.start != 10 || got.end != 12 ||
+		len(got.notes) != 1 || got.date.Format("2006-01-02") != "2001-01-02" {
+		t.Errorf("highlight -> %+v", got)
+	}
+	if got := c.clippings[1]; got.kind != Note || got.text != "Just a note" {
+		t.Errorf("note -> %+v", got)
+	}
+}
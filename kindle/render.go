@@ -0,0 +1,173 @@
+package kindle
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// blockTemplates are the built in templates for the clippings
+//
+//go:embed blocks/*.md
+var blockTemplates embed.FS
+
+// BlockTemplates are the names of the built in templates
+var BlockTemplates = []string{"blockquote", "callout", "table"}
+
+// DefaultBlocks is the built in template used when none is given
+const DefaultBlocks = "blockquote"
+
+// Block is what the block template is given for each clipping
+type Block struct {
+	Kind       string // highlight, note or bookmark
+	Page       int
+	Start, End int       // Location, the same for notes and bookmarks
+	Date       time.Time // Zero if the reader doesn't have it
+	Chapter    string
+	Color      string
+	Text       string
+	Notes      []string // Notes made on a highlight
+	// ASIN is the Amazon id of a Kindle book, if it's known. KindleURL and
+	// CloudURL open the Kindle app and Cloud Reader at the clipping then.
+	ASIN      string
+	KindleURL string
+	CloudURL  string
+	// ID is the block ID, "^{{.ID}}" must end a line of the block, or be
+	// the last cell of a table row, so it's only added once
+	ID string
+}
+
+// blockTemplate renders clippings. header is optional, if there's one it's
+// put before the blocks of each chapter and the blocks aren't separated by
+// blank lines, like the rows of a table.
+type blockTemplate struct {
+	block  *template.Template
+	header *template.Template
+}
+
+var blockFuncs = template.FuncMap{
+	// quote makes each line of txt part of a quote
+	"quote": func(txt string) string {
+		return "> " + strings.ReplaceAll(txt, "\n", "\n> ")
+	},
+	// date is t as 2006-01-02, or "" if it's zero
+	"date": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format("2006-01-02")
+	},
+	// cell makes txt fit in a table cell
+	"cell": func(txt string) string {
+		return strings.NewReplacer("|", `\|`, "\n", "<br>").Replace(txt)
+	},
+	"join": strings.Join,
+}
+
+// loadBlockTemplate parses name, one of BlockTemplates or a file.
+// The file's "block" template is used for each clipping, or the whole file
+// if it doesn't define one, and its "header" template if it has one.
+func loadBlockTemplate(name string) (*blockTemplate, error) {
+	if name == "" {
+		name = DefaultBlocks
+	}
+	var data []byte
+	var err error
+	if filepath.Ext(name) == "" && !strings.ContainsRune(name, filepath.Separator) {
+		data, err = blockTemplates.ReadFile("blocks/" + name + ".md")
+		if err != nil {
+			return nil, fmt.Errorf("unknown template %q, use one of %q or a file", name, BlockTemplates)
+		}
+	} else if data, err = os.ReadFile(name); err != nil {
+		return nil, err
+	}
+	t, err := template.New(filepath.Base(name)).Funcs(blockFuncs).Parse(string(data))
+	if err != nil {
+		return nil, err
+	}
+	bt := &blockTemplate{block: t, header: t.Lookup("header")}
+	if block := t.Lookup("block"); block != nil {
+		bt.block = block
+	}
+	return bt, nil
+}
+
+// blocks returns the template for the clippings, loading it the first time.
+func (c *Conf) blocks() (*blockTemplate, error) {
+	if c.blockTemplate != nil {
+		return c.blockTemplate, nil
+	}
+	bt, err := loadBlockTemplate(c.BlockTemplate)
+	if err != nil {
+		return nil, err
+	}
+	c.blockTemplate = bt
+	return bt, nil
+}
+
+// block is what the template is given for clip
+func (clip Clipping) block() Block {
+	kindle, cloud := clip.links()
+	return Block{
+		Kind:      clip.kind.String(),
+		Page:      clip.page,
+		Start:     clip.start,
+		End:       clip.end,
+		Date:      clip.date,
+		Chapter:   clip.chapter,
+		Color:     clip.color,
+		Text:      clip.text,
+		Notes:     clip.notes,
+		ASIN:      clip.asin,
+		KindleURL: kindle,
+		CloudURL:  cloud,
+		ID:        clip.blockID(),
+	}
+}
+
+// renderBlock returns the text of clip, ending with a newline.
+func (c *Conf) renderBlock(clip Clipping) (string, error) {
+	bt, err := c.blocks()
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	if err := bt.block.Execute(&out, clip.block()); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(out.String(), "\n") + "\n", nil
+}
+
+// linkableBlocks returns false if the blocks are rows, like a table's,
+// which Obsidian can't link to by their block ID.
+func (c *Conf) linkableBlocks() bool {
+	bt, err := c.blocks()
+	return err == nil && bt.header == nil
+}
+
+// renderHeader returns the header that starts each group of blocks, or ""
+// if the template doesn't have one.
+func (c *Conf) renderHeader() (string, error) {
+	bt, err := c.blocks()
+	if err != nil || bt.header == nil {
+		return "", err
+	}
+	var out strings.Builder
+	if err := bt.header.Execute(&out, nil); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(out.String(), "\n") + "\n", nil
+}
+
+// joinBlocks joins the rendered blocks of a group, with a blank line
+// between them unless there's a header.
+func joinBlocks(header string, blocks []string) string {
+	if header == "" {
+		return strings.Join(blocks, "\n")
+	}
+	return header + strings.Join(blocks, "")
+}
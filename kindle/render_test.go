@@ -0,0 +1,151 @@
+package kindle
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mustRender is the block of clip rendered with c's template
+func mustRender(t *testing.T, c *Conf, clip Clipping) string {
+	t.Helper()
+	txt, err := c.renderBlock(clip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return txt
+}
+
+func TestRenderBlock(t *testing.T) {
+	c := &Conf{}
+	if err := c.parse(strings.NewReader(testClippings)); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"- Page: 166 Pos: 2166-2167 Date: 2021-12-11\n> more land and more water are devoted to the cultivation of lawn grass ^kindle-%s-2166-2167\n\nMore grass grown than corn or wheat combined\n",
+		"- Bookmark Page: 171 Pos: 2210 Date: 2021-12-11 ^kindle-%s-2210-2210\n",
+		"- Note Page: 170 Pos: 2200 Date: 2021-12-11\nA lonely note ^kindle-%s-2200-2200\n",
+	}
+	for i, clip := range c.clippings {
+		hash := strings.Split(clip.blockID(), "-")[1]
+		if got, want := mustRender(t, c, clip), fmt.Sprintf(want[i], hash); got != want {
+			t.Errorf("%d -> %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestBlockTemplates(t *testing.T) {
+	date := time.Date(2021, 12, 11, 0, 0, 0, 0, time.UTC)
+	clips := []Clipping{
+		{title: "T", page: 3, start: 1, end: 2, date: date, color: "yellow", text: "a | b\nc", notes: []string{"Mine"}},
+		{title: "T", kind: Bookmark, start: 5, end: 5},
+	}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"callout", "> [!quote] Page 3, location 1-2, 2021-12-11, yellow\n> a | b\n> c\n>\n> **Note:** Mine\n\n^%s\n" +
+			"\n> [!bookmark] Page 0, location 5\n\n^%s\n"},
+		{"table", "| Page | Location | Date | Highlight | Notes | ID |\n| ---- | -------- | ---- | --------- | ----- | -- |\n" +
+			"| 3 | 1-2 | 2021-12-11 | a \\| b<br>c | Mine | ^%s |\n| 0 | 5 |  | *Bookmark* |  | ^%s |\n"},
+	}
+	for _, test := range tests {
+		c := &Conf{BlockTemplate: test.name}
+		got, err := c.renderBlocks(clips)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf(test.want, clips[0].blockID(), clips[1].blockID()); got != want {
+			t.Errorf("%s -> %q, want %q", test.name, got, want)
+		}
+	}
+
+	c := &Conf{BlockTemplate: "fancy"}
+	if _, err := c.renderBlock(clips[0]); err == nil {
+		t.Errorf("unknown template -> no error")
+	}
+}
+
+func TestTableColumns(t *testing.T) {
+	c := &Conf{BlockTemplate: "table"}
+	clips := []Clipping{
+		{title: "T", page: 3, start: 1, end: 2, text: "a | b", notes: []string{"x|y", "z"}},
+		{title: "T", kind: Bookmark, start: 5, end: 5, asin: "B00TEST123"},
+	}
+	txt, err := c.renderBlocks(clips)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// cells counts the cells of a row, leaving out escaped pipes
+	cells := func(row string) int {
+		row = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(row), "|"), "|")
+		return len(strings.Split(strings.ReplaceAll(row, `\|`, ""), "|"))
+	}
+	rows := strings.Split(strings.TrimSuffix(txt, "\n"), "\n")
+	for _, row := range rows[1:] {
+		if got, want := cells(row), cells(rows[0]); got != want {
+			t.Errorf("%q has %d cells, the header has %d", row, got, want)
+		}
+	}
+	for i, clip := range clips {
+		if matches := rxBlockID.FindStringSubmatch(rows[i+2]); matches == nil || matches[1] != clip.blockID() {
+			t.Errorf("%q -> block ID %q, want %q", rows[i+2], matches, clip.blockID())
+		}
+	}
+}
+
+func TestBlockTemplateFile(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "blocks.md")
+	txt := `{{.Kind}} {{.Chapter}} {{.Start}}: {{.Text}}{{range .Notes}} ({{.}}){{end}} ^{{.ID}}`
+	if err := os.WriteFile(fname, []byte(txt), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Conf{BlockTemplate: fname}
+	clip := Clipping{title: "T", chapter: "One", start: 4, end: 5, text: "Hi", notes: []string{"a", "b"}}
+	if got, want := mustRender(t, c, clip), "highlight One 4: Hi (a) (b) ^"+clip.blockID()+"\n"; got != want {
+		t.Errorf("renderBlock -> %q, want %q", got, want)
+	}
+}
+
+func TestMergeTable(t *testing.T) {
+	c := &Conf{BlockTemplate: "table", Header: "## Highlights", MarkDeleted: true}
+	old := Clipping{title: "T", start: 1, end: 2, text: "old"}
+	gone := Clipping{title: "T", start: 3, end: 4, text: "gone"}
+	added := Clipping{title: "T", start: 5, end: 6, text: "new"}
+	txt, err := c.renderBlocks([]Clipping{old, gone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split("## Highlights\n\n"+txt+"\n## After", "\n")
+	got, nAdded, nDeleted, ok, err := c.mergeClippings(lines, []Clipping{old, added})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"## Highlights", "",
+		lines[2], lines[3], lines[4],
+		"| 0 | 3-4 |  | gone |  | " + deletedTag + " ^" + gone.blockID() + " |",
+		"| 0 | 5-6 |  | new |  | ^" + added.blockID() + " |",
+		"",
+		"## After",
+	}
+	if !ok || nAdded != 1 || nDeleted != 1 || !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeClippings -> %d, %d ->\n%s\nwant\n%s", nAdded, nDeleted, strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Callouts have the ID on a line of its own
+	c.BlockTemplate = "callout"
+	c.blockTemplate = nil
+	lines = []string{"## Highlights", "", "> [!quote] Page 0, location 3-4", "> gone", "", "^" + gone.blockID()}
+	got, _, nDeleted, _, err = c.mergeClippings(lines, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line := got[5]; nDeleted != 1 || line != deletedTag+" ^"+gone.blockID() {
+		t.Errorf("mergeClippings callout -> %d, %q", nDeleted, line)
+	}
+}
@@ -0,0 +1,39 @@
+// Package normalize makes titles and author names comparable whatever
+// their case, accents and punctuation.
+package normalize
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Text lower cases txt, removes accents and apostrophes and replaces
+// other punctuation with single spaces.
+func Text(txt string) string {
+	// Decomposed, the accents are marks of their own that can be removed
+	unaccent := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	if plain, _, err := transform.String(unaccent, txt); err == nil {
+		txt = plain
+	}
+	txt = strings.NewReplacer("’", "", "'", "").Replace(strings.ToLower(txt))
+	txt = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return ' '
+	}, txt)
+	return strings.Join(strings.Fields(txt), " ")
+}
+
+// Author makes "Gawdat, Mo", "Mo Gawdat" and "(Gawdat, Mo)" the same by
+// sorting the words of the name.
+func Author(author string) string {
+	words := strings.Fields(Text(author))
+	sort.Strings(words)
+	return strings.Join(words, " ")
+}
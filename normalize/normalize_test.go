@@ -0,0 +1,31 @@
+package normalize
+
+import "testing"
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"The Anthropocene Reviewed", "the anthropocene reviewed"},
+		{"Sönke  Ahrens", "sonke ahrens"},
+		{"Gabriel García Márquez", "gabriel garcia marquez"},
+		{"Tomáš Sedláček", "tomas sedlacek"},
+		{"An Optimist's Playbook—for   Our Future!", "an optimists playbook for our future"},
+		{"Elizabeth Magie’s", "elizabeth magies"},
+		{`\#Girlboss`, "girlboss"},
+	}
+	for _, test := range tests {
+		if got := Text(test.in); got != test.want {
+			t.Errorf("%q -> %q, want %q\n", test.in, got, test.want)
+		}
+	}
+}
+
+func TestAuthor(t *testing.T) {
+	for _, in := range []string{"Gawdat, Mo", "Mo Gawdat", "(Gawdat, Mo)", "Gawdat,  MO"} {
+		if got := Author(in); got != "gawdat mo" {
+			t.Errorf("%q -> %q, want %q", in, got, "gawdat mo")
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Package region finds the part of a note that a tool owns. It's marked
+// with Obsidian comments, which aren't shown in the preview:
+//
+//	%% begin kindle %%
+//	...
+//	%% end kindle %%
+//
+// Tools only rewrite the lines between their own markers so other tools
+// and hand-written text can share the note.
+package region
+
+import "strings"
+
+// Begin returns the line that starts the region name
+func Begin(name string) string {
+	return "%% begin " + name + " %%"
+}
+
+// End returns the line that ends the region name
+func End(name string) string {
+	return "%% end " + name + " %%"
+}
+
+// isMarker is true if line is the begin or end marker of name,
+// ignoring extra spaces.
+func isMarker(line, which, name string) bool {
+	fields := strings.Fields(line)
+	return len(fields) == 4 && fields[0] == "%%" && fields[1] == which && fields[2] == name && fields[3] == "%%"
+}
+
+// Find returns the indexes of the begin and end marker lines of name,
+// or -1, -1 if lines doesn't have both.
+func Find(lines []string, name string) (begin, end int) {
+	for i, line := range lines {
+		if !isMarker(line, "begin", name) {
+			continue
+		}
+		for j := i + 1; j < len(lines); j++ {
+			if isMarker(lines[j], "end", name) {
+				return i, j
+			}
+		}
+		break
+	}
+	return -1, -1
+}
+
+// Has is true if lines has the region name.
+func Has(lines []string, name string) bool {
+	begin, _ := Find(lines, name)
+	return begin != -1
+}
+
+// Get returns the lines between the markers of name, or false if there's
+// no such region.
+func Get(lines []string, name string) ([]string, bool) {
+	begin, end := Find(lines, name)
+	if begin == -1 {
+		return nil, false
+	}
+	return lines[begin+1 : end], true
+}
+
+// Replace returns lines with the ones between the markers of name replaced
+// by content, or false if there's no such region.
+func Replace(lines []string, name string, content []string) ([]string, bool) {
+	begin, end := Find(lines, name)
+	if begin == -1 {
+		return lines, false
+	}
+	ret := make([]string, 0, len(lines)-(end-begin-1)+len(content))
+	ret = append(ret, lines[:begin+1]...)
+	ret = append(ret, content...)
+	return append(ret, lines[end:]...), true
+}
+
+// Wrap returns content between the markers of name.
+func Wrap(name string, content []string) []string {
+	ret := make([]string, 0, len(content)+2)
+	ret = append(ret, Begin(name))
+	ret = append(ret, content...)
+	return append(ret, End(name))
+}
@@ -0,0 +1,44 @@
+package region
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	tests := []struct {
+		lines      []string
+		begin, end int
+	}{
+		{nil, -1, -1},
+		{[]string{"a", "%% begin kindle %%", "b", "%% end kindle %%"}, 1, 3},
+		{[]string{"%%  begin kindle %% ", "%% end kindle %%"}, 0, 1},
+		{[]string{"%% begin kindle %%", "b"}, -1, -1},
+		{[]string{"%% end kindle %%", "%% begin kindle %%"}, -1, -1},
+		{[]string{"%% begin goodreads %%", "%% end goodreads %%"}, -1, -1},
+	}
+	for _, test := range tests {
+		begin, end := Find(test.lines, "kindle")
+		if begin != test.begin || end != test.end {
+			t.Errorf("%q -> %d, %d, want %d, %d\n", test.lines, begin, end, test.begin, test.end)
+		}
+	}
+}
+
+func TestReplace(t *testing.T) {
+	lines := []string{"# Book", Begin("kindle"), "old", "older", End("kindle"), "mine"}
+	got, ok := Replace(lines, "kindle", []string{"new"})
+	want := []string{"# Book", Begin("kindle"), "new", End("kindle"), "mine"}
+	if !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("Replace -> %q, %v, want %q", got, ok, want)
+	}
+	if content, ok := Get(got, "kindle"); !ok || !reflect.DeepEqual(content, []string{"new"}) {
+		t.Errorf("Get -> %q, %v", content, ok)
+	}
+	if _, ok := Replace(lines, "goodreads", nil); ok {
+		t.Errorf("Replace of a missing region should fail")
+	}
+	if got := Wrap("x", []string{"a"}); !reflect.DeepEqual(got, []string{"%% begin x %%", "a", "%% end x %%"}) {
+		t.Errorf("Wrap -> %q", got)
+	}
+}
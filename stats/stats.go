@@ -0,0 +1,396 @@
+// Package stats writes a note with reading statistics from the books of a
+// Goodreads export and the Kindle highlights, as Markdown tables and
+// Mermaid charts.
+package stats
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scottkirkwood/obsidian/goodreads"
+	"github.com/scottkirkwood/obsidian/region"
+)
+
+const (
+	// DefaultOutput is the note written, relative to the vault
+	DefaultOutput = "Reading stats.md"
+	// regionName marks the part of the note with the statistics
+	regionName = "stats"
+	// topAuthors and topHighlights are how many rows those tables have
+	topAuthors    = 10
+	topHighlights = 20
+)
+
+var months = []string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+
+// Report is the statistics of books and highlights
+type Report struct {
+	// Books are from any of the goodreads Importers
+	Books []*goodreads.Book
+	// Highlights is how many highlights each book has, by a link to its
+	// note or the title
+	Highlights map[string]int
+}
+
+// readBook is a book that was read, with its dates parsed
+type readBook struct {
+	*goodreads.Book
+	read, added time.Time
+	pages       int
+}
+
+// count is how many of something there are
+type count struct {
+	name string
+	n    int
+}
+
+// read returns the books that were read.
+func (r *Report) read() []readBook {
+	var ret []readBook
+	for _, book := range r.Books {
+		if book.ExclusiveShelf != "read" && book.DateRead == "" {
+			continue
+		}
+		pages := 0
+		if txt := strings.TrimSpace(book.Pages); txt != "" {
+			var err error
+			if pages, err = strconv.Atoi(txt); err != nil {
+				fmt.Printf("Not counting the pages of %q, %v\n", book.Title, err)
+			}
+		}
+		ret = append(ret, readBook{
+			Book:  book,
+			read:  goodreads.ParseDate(book.DateRead),
+			added: goodreads.ParseDate(book.DateAdded),
+			pages: pages,
+		})
+	}
+	return ret
+}
+
+// Markdown returns the statistics as sections of Markdown.
+func (r *Report) Markdown() string {
+	read := r.read()
+	sections := []string{
+		fmt.Sprintf("%d books, %d read, %d highlights.\n", len(r.Books), len(read), sum(r.Highlights)),
+		r.perYear(read),
+		r.perMonth(read),
+		r.ratings(),
+		r.shelves(),
+		r.authors(read),
+		r.highlights(),
+		r.lag(read),
+	}
+	return strings.Join(sections, "\n")
+}
+
+// perYear is the books and pages read each year.
+func (r *Report) perYear(read []readBook) string {
+	books, pages, lags := map[int]int{}, map[int]int{}, map[int][]int{}
+	for _, book := range read {
+		if book.read.IsZero() {
+			continue
+		}
+		year := book.read.Year()
+		books[year]++
+		pages[year] += book.pages
+		if lag, ok := book.lag(); ok {
+			lags[year] = append(lags[year], lag)
+		}
+	}
+	years := sortedYears(books)
+	rows := make([][]string, len(years))
+	labels := make([]string, len(years))
+	bookCounts := make([]int, len(years))
+	pageCounts := make([]int, len(years))
+	for i, year := range years {
+		labels[i] = strconv.Itoa(year)
+		bookCounts[i] = books[year]
+		pageCounts[i] = pages[year]
+		rows[i] = []string{labels[i], strconv.Itoa(books[year]), strconv.Itoa(pages[year]), average(lags[year])}
+	}
+	return "## Books read per year\n\n" +
+		table([]string{"Year", "Books", "Pages", "Days from added"}, rows) + "\n" +
+		barChart("Books read per year", "Books", labels, bookCounts) + "\n" +
+		"## Pages read per year\n\n" +
+		barChart("Pages read per year", "Pages", labels, pageCounts)
+}
+
+// perMonth is the books read each month of each year, and of all years.
+func (r *Report) perMonth(read []readBook) string {
+	perYear, books := map[int][]int{}, map[int]int{}
+	total := make([]int, 12)
+	for _, book := range read {
+		if book.read.IsZero() {
+			continue
+		}
+		year := book.read.Year()
+		if perYear[year] == nil {
+			perYear[year] = make([]int, 12)
+		}
+		perYear[year][book.read.Month()-1]++
+		books[year]++
+		total[book.read.Month()-1]++
+	}
+	var rows [][]string
+	for _, year := range sortedYears(books) {
+		row := []string{strconv.Itoa(year)}
+		for _, n := range perYear[year] {
+			row = append(row, strconv.Itoa(n))
+		}
+		rows = append(rows, row)
+	}
+	return "## Books read per month\n\n" +
+		table(append([]string{"Year"}, months...), rows) + "\n" +
+		barChart("Books read by month, all years", "Books", months, total)
+}
+
+// ratings is how many books were given each rating.
+func (r *Report) ratings() string {
+	ratings := map[string]int{}
+	for _, book := range r.Books {
+		if rating := strings.TrimSpace(book.Rating); rating != "" && rating != "0" {
+			ratings[rating]++
+		}
+	}
+	counts := sortedCounts(ratings)
+	sort.Slice(counts, func(i, j int) bool {
+		return counts[i].name > counts[j].name
+	})
+	for i := range counts {
+		if counts[i].name == "1" {
+			counts[i].name += " star"
+		} else {
+			counts[i].name += " stars"
+		}
+	}
+	return "## Ratings\n\n" + countTable("Rating", "Books", counts) + "\n" + pieChart("Ratings", counts)
+}
+
+// shelves is how many books are on each shelf.
+func (r *Report) shelves() string {
+	exclusive, shelves := map[string]int{}, map[string]int{}
+	for _, book := range r.Books {
+		if book.ExclusiveShelf != "" {
+			exclusive[book.ExclusiveShelf]++
+		}
+		for _, shelf := range strings.Split(book.Bookshelves, ",") {
+			if shelf = strings.TrimSpace(shelf); shelf != "" && shelf != book.ExclusiveShelf {
+				shelves[shelf]++
+			}
+		}
+	}
+	for shelf, n := range exclusive {
+		shelves[shelf] += n
+	}
+	return "## Shelves\n\n" + countTable("Shelf", "Books", sortedCounts(shelves)) + "\n" +
+		pieChart("Exclusive shelves", sortedCounts(exclusive))
+}
+
+// authors is the authors with the most books read.
+func (r *Report) authors(read []readBook) string {
+	books, pages := map[string]int{}, map[string]int{}
+	for _, book := range read {
+		if book.Author != "" {
+			books[book.Author]++
+			pages[book.Author] += book.pages
+		}
+	}
+	counts := sortedCounts(books)
+	if len(counts) > topAuthors {
+		counts = counts[:topAuthors]
+	}
+	rows := make([][]string, len(counts))
+	for i, c := range counts {
+		rows[i] = []string{cell(c.name), strconv.Itoa(c.n), strconv.Itoa(pages[c.name])}
+	}
+	return "## Top authors\n\n" + table([]string{"Author", "Books", "Pages"}, rows)
+}
+
+// highlights is the books with the most highlights.
+func (r *Report) highlights() string {
+	counts := sortedCounts(r.Highlights)
+	if len(counts) > topHighlights {
+		counts = counts[:topHighlights]
+	}
+	if len(counts) == 0 {
+		return "## Highlights per book\n\nNo highlights.\n"
+	}
+	return "## Highlights per book\n\n" + countTable("Book", "Highlights", counts)
+}
+
+// lag is how long books waited between being added and read.
+func (r *Report) lag(read []readBook) string {
+	var lags []int
+	for _, book := range read {
+		if lag, ok := book.lag(); ok {
+			lags = append(lags, lag)
+		}
+	}
+	if len(lags) == 0 {
+		return "## Time to read\n\nNo books with both dates.\n"
+	}
+	sort.Ints(lags)
+	return fmt.Sprintf("## Time to read\n\nBooks were read on average %s days after being added, half within %d days, over %d books.\n",
+		average(lags), lags[len(lags)/2], len(lags))
+}
+
+// lag is the days between the book being added and read, false if it
+// doesn't have both or was read first.
+func (b readBook) lag() (int, bool) {
+	if b.read.IsZero() || b.added.IsZero() || b.read.Before(b.added) {
+		return 0, false
+	}
+	return int(b.read.Sub(b.added).Hours() / 24), true
+}
+
+// table is a Markdown table with header and rows.
+func table(header []string, rows [][]string) string {
+	lines := []string{row(header)}
+	seps := make([]string, len(header))
+	for i, h := range header {
+		seps[i] = strings.Repeat("-", len(h))
+	}
+	lines = append(lines, row(seps))
+	for _, r := range rows {
+		lines = append(lines, row(r))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func row(cells []string) string {
+	return "| " + strings.Join(cells, " | ") + " |"
+}
+
+// cell makes txt fit in a table cell
+func cell(txt string) string {
+	return strings.ReplaceAll(txt, "|", `\|`)
+}
+
+// countTable is a table of the names and counts of what they have.
+func countTable(name, what string, counts []count) string {
+	rows := make([][]string, len(counts))
+	for i, c := range counts {
+		rows[i] = []string{cell(c.name), strconv.Itoa(c.n)}
+	}
+	return table([]string{name, what}, rows)
+}
+
+// barChart is a Mermaid bar chart of values.
+func barChart(title, axis string, labels []string, values []int) string {
+	if len(values) == 0 {
+		return ""
+	}
+	quoted := make([]string, len(labels))
+	for i, label := range labels {
+		quoted[i] = strconv.Quote(label)
+	}
+	nums := make([]string, len(values))
+	for i, v := range values {
+		nums[i] = strconv.Itoa(v)
+	}
+	return "```mermaid\nxychart-beta\n" +
+		"    title " + strconv.Quote(title) + "\n" +
+		"    x-axis [" + strings.Join(quoted, ", ") + "]\n" +
+		"    y-axis " + strconv.Quote(axis) + "\n" +
+		"    bar [" + strings.Join(nums, ", ") + "]\n```\n"
+}
+
+// pieChart is a Mermaid pie chart of counts.
+func pieChart(title string, counts []count) string {
+	if len(counts) == 0 {
+		return ""
+	}
+	lines := []string{"```mermaid", "pie title " + title}
+	for _, c := range counts {
+		lines = append(lines, fmt.Sprintf("    %s : %d", strconv.Quote(c.name), c.n))
+	}
+	return strings.Join(append(lines, "```"), "\n") + "\n"
+}
+
+// sortedCounts returns counts by the most first, then by name.
+func sortedCounts(counts map[string]int) []count {
+	ret := make([]count, 0, len(counts))
+	for name, n := range counts {
+		ret = append(ret, count{name, n})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].n != ret[j].n {
+			return ret[i].n > ret[j].n
+		}
+		return ret[i].name < ret[j].name
+	})
+	return ret
+}
+
+// sortedYears returns the years of m in order.
+func sortedYears(m map[int]int) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+func sum(counts map[string]int) int {
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	return total
+}
+
+// average is the rounded average of nums, or "" if there are none.
+func average(nums []int) string {
+	if len(nums) == 0 {
+		return ""
+	}
+	total := 0
+	for _, n := range nums {
+		total += n
+	}
+	return strconv.Itoa((total + len(nums)/2) / len(nums))
+}
+
+// Write writes the report to the stats region of fname, making the note
+// if it doesn't exist. Text outside the region is kept.
+func (r *Report) Write(fname string, dryRun bool) error {
+	content := []string{r.Markdown()}
+	data, err := os.ReadFile(fname)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var lines []string
+	if os.IsNotExist(err) {
+		lines = append([]string{"# Reading stats", ""}, region.Wrap(regionName, content)...)
+	} else if replaced, ok := region.Replace(strings.Split(string(data), "\n"), regionName, content); ok {
+		lines = replaced
+	} else {
+		lines = append(strings.Split(strings.TrimRight(string(data), "\n"), "\n"), "")
+		lines = append(lines, region.Wrap(regionName, content)...)
+	}
+	txt := strings.Join(lines, "\n")
+	if !strings.HasSuffix(txt, "\n") {
+		txt += "\n"
+	}
+	if txt == string(data) {
+		fmt.Printf("No changes to %q\n", fname)
+		return nil
+	}
+	if dryRun {
+		fmt.Printf("Would write %q\n", fname)
+		return nil
+	}
+	fmt.Printf("Writing %q\n", fname)
+	if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(fname, []byte(txt), 0644)
+}
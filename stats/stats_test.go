@@ -0,0 +1,92 @@
+package stats
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottkirkwood/obsidian/goodreads"
+)
+
+func testReport() *Report {
+	return &Report{
+		Books: []*goodreads.Book{
+			{Title: "A", Author: "Ann", Pages: "100", Rating: "5", ExclusiveShelf: "read", Bookshelves: "audio-book", DateAdded: "2020/01/01", DateRead: "2020/01/11"},
+			{Title: "B", Author: "Ann", Pages: "200", Rating: "4", ExclusiveShelf: "read", DateAdded: "2020/01/01", DateRead: "2021/01/01"},
+			{Title: "C", Author: "Bob", Pages: "50", Rating: "1", ExclusiveShelf: "read", Bookshelves: "audio-book, read", DateRead: "2021/03/05"},
+			{Title: "D", Author: "Cy", Rating: "0", ExclusiveShelf: "to-read", Bookshelves: "to-read"},
+		},
+		Highlights: map[string]int{"[[A]]": 3, "C (Bob)": 7},
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	md := testReport().Markdown()
+	for _, want := range []string{
+		"4 books, 3 read, 10 highlights.",
+		"| 2020 | 1 | 100 | 10 |",
+		"| 2021 | 2 | 250 | 366 |",
+		`    x-axis ["2020", "2021"]`,
+		"    bar [1, 2]",
+		"    bar [100, 250]",
+		"| 2021 | 1 | 0 | 1 | 0 | 0 | 0 | 0 | 0 | 0 | 0 | 0 | 0 |",
+		"| 5 stars | 1 |\n| 4 stars | 1 |\n| 1 star | 1 |",
+		`    "read" : 3`,
+		"| read | 3 |\n| audio-book | 2 |\n| to-read | 1 |",
+		"| Ann | 2 | 300 |\n| Bob | 1 | 50 |",
+		"| C (Bob) | 7 |\n| [[A]] | 3 |",
+		"on average 188 days after being added, half within 366 days, over 2 books.",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("no %q in\n%s", want, md)
+		}
+	}
+}
+
+func TestReadPages(t *testing.T) {
+	r := &Report{Books: []*goodreads.Book{
+		{Title: "A", Pages: " 120 ", ExclusiveShelf: "read"},
+		{Title: "B", Pages: "about 90", ExclusiveShelf: "read"},
+		{Title: "C", ExclusiveShelf: "read"},
+	}}
+	read := r.read()
+	if len(read) != 3 {
+		t.Fatalf("read() -> %d books, want 3", len(read))
+	}
+	for i, want := range []int{120, 0, 0} {
+		if read[i].pages != want {
+			t.Errorf("%s pages = %d, want %d", read[i].Title, read[i].pages, want)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "Stats.md")
+	r := testReport()
+	if err := r.Write(fname, false); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "# Reading stats\n\n%% begin stats %%\n") {
+		t.Errorf("new note starts with %q", strings.SplitN(string(data), "\n", 4)[:3])
+	}
+
+	// Text around the region is kept
+	note := "# Mine\n\nBefore\n" + strings.TrimPrefix(string(data), "# Reading stats\n") + "After\n"
+	if err := os.WriteFile(fname, []byte(note), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r.Highlights["B (Ann)"] = 1
+	if err := r.Write(fname, false); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(fname)
+	got := string(data)
+	if !strings.HasPrefix(got, "# Mine\n\nBefore\n") || !strings.HasSuffix(got, "%% end stats %%\nAfter\n") || !strings.Contains(got, "| B (Ann) | 1 |") {
+		t.Errorf("Write ->\n%s", got)
+	}
+}